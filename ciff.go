@@ -0,0 +1,231 @@
+package exif4go
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// ciffSignature follows the byte order and the header length of a Canon CRW file.
+const ciffSignature = "HEAPCCDR"
+
+// maxCiffDepth bounds the nesting of the CIFF heaps.
+const maxCiffDepth = 8
+
+// CIFF records by ID, the lower 14 bits of the record tag.
+// The IDs include the data type, e.g. 0x0800 for ASCII strings.
+var ciffTags = map[int]*exifTag{
+	0x0805: &exifTag{"CanonFileDescription", nil, nil},
+	0x080A: &exifTag{"CanonRawMakeModel", nil, nil},
+	0x080B: &exifTag{"CanonFirmwareVersion", nil, nil},
+	0x080C: &exifTag{"ComponentVersion", nil, nil},
+	0x080D: &exifTag{"ROMOperationMode", nil, nil},
+	0x0810: &exifTag{"OwnerName", nil, nil},
+	0x0815: &exifTag{"CanonImageType", nil, nil},
+	0x0816: &exifTag{"OriginalFileName", nil, nil},
+	0x0817: &exifTag{"ThumbnailFileName", nil, nil},
+	0x100A: &exifTag{"TargetImageType", nil, nil},
+	0x1010: &exifTag{"ShutterReleaseMethod", nil, nil},
+	0x1011: &exifTag{"ShutterReleaseTiming", nil, nil},
+	0x1016: &exifTag{"ReleaseSetting", nil, nil},
+	0x101C: &exifTag{"BaseISO", nil, nil},
+	0x1029: &exifTag{"FocalLength", nil, nil},
+	0x102A: &exifTag{"CanonShotInfo", nil, nil},
+	0x102D: &exifTag{"CanonCameraSettings", nil, nil},
+	0x1031: &exifTag{"SensorInfo", nil, nil},
+	0x1033: &exifTag{"CustomFunctions", nil, nil},
+	0x1038: &exifTag{"CanonAFInfo", nil, nil},
+	0x10A9: &exifTag{"ColorBalance", nil, nil},
+	0x10B4: &exifTag{"ColorSpace", nil, nil},
+	0x1803: &exifTag{"ImageFormat", nil, nil},
+	0x1804: &exifTag{"RecordID", nil, nil},
+	0x1806: &exifTag{"SelfTimerTime", nil, nil},
+	0x1807: &exifTag{"TargetDistanceSetting", nil, nil},
+	0x180B: &exifTag{"SerialNumber", nil, nil},
+	0x180E: &exifTag{"TimeStamp", nil, nil},
+	0x1810: &exifTag{"ImageInfo", nil, nil},
+	0x1813: &exifTag{"FlashInfo", nil, nil},
+	0x1814: &exifTag{"MeasuredEV", nil, nil},
+	0x1817: &exifTag{"FileNumber", nil, nil},
+	0x1818: &exifTag{"ExposureInfo", nil, nil},
+	0x1834: &exifTag{"CanonModelID", nil, nil},
+	0x2005: &exifTag{"RawData", nil, nil},
+	0x2007: &exifTag{"JpgFromRaw", nil, nil},
+	0x2008: &exifTag{"ThumbnailImage", nil, nil},
+}
+
+// ciffFieldType returns the TIFF field type matching the data type bits of a CIFF record tag.
+func ciffFieldType(tag int) int {
+	switch tag & 0x3800 {
+	case 0x0000:
+		return 1
+	case 0x0800:
+		return 2
+	case 0x1000:
+		return 3
+	case 0x1800:
+		return 4
+	}
+	return 7
+}
+
+// dumpHeap stores the records of the CIFF heap between start and end with the "CIFF" IFD name,
+// in file order, the subdirectories are walked recursively. seen holds the heaps already walked: each heap is
+// walked once and at most MaxIfds heaps are walked, so that heaps referring many times to the
+// same subdirectories cannot hang the decoder.
+func (eh *exifHeader) dumpHeap(start int, end int, depth int, seen map[[2]int]bool) error {
+	if depth > maxCiffDepth {
+		return &FormatError{Ifd: "CIFF", Tag: -1, Offset: int64(start), Err: fmt.Errorf("more than %d nested heaps", maxCiffDepth)}
+	}
+	if seen[[2]int{start, end}] || len(seen) >= eh.opts.MaxIfds {
+		return &FormatError{Ifd: "CIFF", Tag: -1, Offset: int64(start), Err: fmt.Errorf("heap walked twice or more than %d heaps", eh.opts.MaxIfds)}
+	}
+	seen[[2]int{start, end}] = true
+	table, err := eh.s2n(end-4, 4, false)
+	if err != nil {
+		return err
+	}
+	table += start
+	count, err := eh.s2n(table, 2, false)
+	if err != nil {
+		return err
+	}
+	for i := 0; i < count; i++ {
+		entry := table + 2 + 10*i
+		tag, err := eh.s2n(entry, 2, false)
+		if err != nil {
+			return err
+		}
+		var offset, length int
+		if tag&0xC000 == 0x4000 {
+			// the value is stored in the record itself
+			offset, length = entry+2, 8
+		} else {
+			if length, err = eh.s2n(entry+2, 4, false); err != nil {
+				return err
+			}
+			if offset, err = eh.s2n(entry+6, 4, false); err != nil {
+				return err
+			}
+			offset += start
+		}
+		if offset < start || length < 0 || offset+length > end {
+			return &FormatError{Ifd: "CIFF", Tag: tag & 0x3FFF, Offset: int64(entry), Err: ErrInvalidOffset}
+		}
+
+		if t := tag & 0x3800; t == 0x2800 || t == 0x3000 {
+			// subdirectory
+			if err := eh.dumpHeap(offset, offset+length, depth+1, seen); err != nil {
+				return err
+			}
+			continue
+		}
+		id := tag & 0x3FFF
+		name := fmt.Sprintf("Tag 0x%04X", id)
+		if entryTag, ok := ciffTags[id]; ok {
+			name = entryTag.name
+		}
+		fieldtype := ciffFieldType(tag)
+		size := int(FieldTypeOf(fieldtype).Size)
+		count := length / size
+		var raw []byte
+		if count <= eh.opts.MaxValues {
+			if raw, err = eh.readBytes(offset, count*size); err != nil {
+				return err
+			}
+		}
+		var t *IfdTag
+		if raw != nil {
+			t = newTag(id, fieldtype, count, raw, eh.byteOrder())
+			t.fieldoffset, t.fieldlength = offset, length
+		} else {
+			// large data such as the raw image, only located
+			t = &IfdTag{"", id, fieldtype, offset, length, nil, count, nil, eh.byteOrder(), 0, 0, 0, false}
+		}
+		t.EntryOffset, t.ValueOffset, t.ValueLength = eh.offset+int64(entry), eh.offset+int64(offset), int64(length)
+		t.Inline = tag&0xC000 == 0x4000
+		eh.entries["CIFF"] = append(eh.entries["CIFF"], IfdEntry{name, t})
+		eh.opts.writeInfo(" DEBUG:   "+name+":", t)
+	}
+	return nil
+}
+
+// ciffDecode decodes the Canon CRW file of the given size read through r. The CIFF records are
+// stored in the "CIFF" IFD, the only IFD of Exif.Ifds, and the usual tags are derived from them: the make, model,
+// owner, firmware, capture time and image size, plus the MakerNote camera settings and shot
+// information when o.Details is set.
+func ciffDecode(r io.ReaderAt, size int64, o *Options) (*Exif, error) {
+	b := make([]byte, 6)
+	if _, err := r.ReadAt(b, 0); err != nil {
+		return nil, newFormatError(err, 0, 6, size)
+	}
+	hdr := newExifHeader(r, size, b[0:1], 0, o)
+	start, err := hdr.s2n(2, 4, false)
+	if err != nil {
+		return nil, err
+	}
+	if err := o.tolerate(hdr.dumpHeap(start, int(size), 0, make(map[[2]int]bool))); err != nil {
+		return nil, err
+	}
+	// the records of all the heaps make up a single IFD
+	ciff := hdr.takeIfd("CIFF", int64(start), ciffTags)
+	x := &Exif{Tags: hdr.tags, Ifds: []*Ifd{ciff}, Format: "CRW", hdr: hdr}
+
+	str := func(name string) string {
+		if t, ok := hdr.tags["CIFF "+name]; ok {
+			return strings.TrimRight(string(t.raw), "\x00")
+		}
+		return ""
+	}
+	if mm := strings.SplitN(str("CanonRawMakeModel"), "\x00", 2); len(mm) == 2 {
+		hdr.setTag(ImageMake, NewASCIITag(0x010F, mm[0]))
+		hdr.setTag(ImageModel, NewASCIITag(0x0110, strings.TrimRight(mm[1], "\x00")))
+	}
+	if s := str("CanonFirmwareVersion"); s != "" {
+		hdr.setTag(ImageSoftware, NewASCIITag(0x0131, s))
+	}
+	if s := str("OwnerName"); s != "" {
+		hdr.setTag(ExifCameraOwnerName, NewASCIITag(0xA430, s))
+	}
+	if t, ok := hdr.tags["CIFF TimeStamp"]; ok {
+		// seconds since 1970 on the camera clock
+		if v, err := t.Int(0); err == nil && v > 0 {
+			dt := time.Unix(v, 0).UTC().Format("2006:01:02 15:04:05")
+			hdr.setTag(ExifDateTimeOriginal, NewASCIITag(0x9003, dt))
+		}
+	}
+	if t, ok := hdr.tags["CIFF ImageInfo"]; ok {
+		w, err1 := t.Int(0)
+		h, err2 := t.Int(1)
+		if err1 == nil && err2 == nil {
+			hdr.setTag(ExifImageWidth, NewLongTag(0xA002, uint32(w)))
+			hdr.setTag(ExifImageLength, NewLongTag(0xA003, uint32(h)))
+		}
+	}
+	if o.Details {
+		if t, ok := hdr.tags["CIFF CanonCameraSettings"]; ok {
+			hdr.canonDecodeTag(t, makerNoteCanonTags_0x001)
+		}
+		if t, ok := hdr.tags["CIFF CanonShotInfo"]; ok {
+			hdr.canonDecodeTag(t, makerNoteCanonTags_0x004)
+		}
+	}
+	if t, ok := hdr.tags["CIFF ThumbnailImage"]; ok {
+		thumb, err := hdr.readBytes(t.fieldoffset, t.fieldlength)
+		if err := o.tolerate(err); err != nil {
+			return nil, err
+		}
+		x.thumbnail = thumb
+	}
+	return x, nil
+}
+
+// isCiff tells whether the file read through r starts with the header of a Canon CRW file.
+func isCiff(r io.ReaderAt) bool {
+	b := make([]byte, 14)
+	if _, err := r.ReadAt(b, 0); err != nil {
+		return false
+	}
+	return (string(b[0:2]) == "II" || string(b[0:2]) == "MM") && string(b[6:14]) == ciffSignature
+}
@@ -0,0 +1,127 @@
+package exif4go
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"strings"
+	"testing"
+)
+
+// ciffRecord is a CIFF heap record, tag including the data type bits.
+type ciffRecord struct {
+	tag  int
+	data []byte
+}
+
+// ciffHeap returns a little endian CIFF heap holding the records.
+func ciffHeap(records ...ciffRecord) []byte {
+	var data []byte
+	table := []byte{}
+	le := binary.LittleEndian
+	table = le.AppendUint16(table, uint16(len(records)))
+	for _, r := range records {
+		table = le.AppendUint16(table, uint16(r.tag))
+		table = le.AppendUint32(table, uint32(len(r.data)))
+		table = le.AppendUint32(table, uint32(len(data)))
+		data = append(data, r.data...)
+	}
+	return le.AppendUint32(append(data, table...), uint32(len(data)))
+}
+
+// ciffRepeat returns a CIFF heap holding sub once, referred to by n subdirectory records.
+func ciffRepeat(sub []byte, n int) []byte {
+	le := binary.LittleEndian
+	table := le.AppendUint16(nil, uint16(n))
+	for i := 0; i < n; i++ {
+		table = le.AppendUint16(table, 0x300A)
+		table = le.AppendUint32(table, uint32(len(sub)))
+		table = le.AppendUint32(table, 0)
+	}
+	return le.AppendUint32(append(append([]byte{}, sub...), table...), uint32(len(sub)))
+}
+
+// longs returns little endian 32 bits integers.
+func longs(v ...uint32) []byte {
+	var b []byte
+	for _, x := range v {
+		b = binary.LittleEndian.AppendUint32(b, x)
+	}
+	return b
+}
+
+func TestCRW(t *testing.T) {
+	preview := previewJPEG(t)
+	thumb := []byte("\xFF\xD8\xFF\xD9")
+	settings := make([]byte, 2*20)
+	binary.LittleEndian.PutUint16(settings, uint16(len(settings)))
+	// FocusMode: AI Focus
+	binary.LittleEndian.PutUint16(settings[2*7:], 2)
+	props := ciffHeap(
+		ciffRecord{0x080A, []byte("Canon\x00Canon PowerShot G2\x00")},
+		ciffRecord{0x180E, longs(1038744000, 0, 0)},
+		ciffRecord{0x1810, longs(2272, 1704, 0, 0, 12, 24, 0)},
+		ciffRecord{0x102D, settings},
+	)
+	heap := ciffHeap(
+		ciffRecord{0x300A, props},
+		ciffRecord{0x2007, preview},
+		ciffRecord{0x2008, thumb},
+	)
+	b := append([]byte("II\x1A\x00\x00\x00HEAPCCDR\x02\x00\x01\x00\x00\x00\x00\x00\x00\x00\x00\x00"), heap...)
+
+	x, err := Decode(bytes.NewReader(b), int64(len(b)), &Options{Details: true})
+	if err != nil {
+		t.Fatalf("There was an error: %s", err)
+	}
+	if x.Format != "CRW" {
+		t.Errorf("Expected the CRW format, got %s", x.Format)
+	}
+	expected := map[string]string{
+		"Image Make":            `"Canon"`,
+		"Image Model":           `"Canon PowerShot G2"`,
+		"EXIF DateTimeOriginal": `"2002:12:01 12:00:00"`,
+		"EXIF ExifImageWidth":   "2272",
+		"EXIF ExifImageLength":  "1704",
+		"MakerNote FocusMode":   "AI Focus",
+	}
+	for k, v := range expected {
+		if tag, ok := x.Tags[k]; !ok || tag.Printable != v {
+			t.Errorf("Expected %s to be %s, got %v", k, v, tag)
+		}
+	}
+	var names []string
+	for _, e := range x.Ifds[0].Entries {
+		names = append(names, e.Name)
+	}
+	if strings.Join(names, ", ") != "CanonRawMakeModel, TimeStamp, ImageInfo, CanonCameraSettings, JpgFromRaw, ThumbnailImage" {
+		t.Errorf("Unexpected CIFF records %v", names)
+	}
+	if tag, ok := x.Get(ImageModel); !ok || tag.Printable != `"Canon PowerShot G2"` {
+		t.Errorf("Expected the model, got %v", tag)
+	}
+	if p, err := x.Preview(); err != nil || !bytes.Equal(p, preview) {
+		t.Errorf("Expected the %d bytes preview, got %d bytes (%v)", len(preview), len(p), err)
+	}
+	if th, err := x.Thumbnail(); err != nil || !bytes.Equal(th, thumb) {
+		t.Errorf("Expected the thumbnail, got %v (%v)", th, err)
+	}
+
+	// 8 nested heaps of 30 records referring to the same subdirectory, 30^8 walks unless
+	// each heap is walked once
+	heap = ciffHeap(ciffRecord{0x080A, []byte("Canon\x00Canon PowerShot G2\x00")})
+	for i := 0; i < 8; i++ {
+		heap = ciffRepeat(heap, 30)
+	}
+	b = append([]byte("II\x1A\x00\x00\x00HEAPCCDR\x02\x00\x01\x00\x00\x00\x00\x00\x00\x00\x00\x00"), heap...)
+	if x, err = Decode(bytes.NewReader(b), int64(len(b)), nil); err != nil {
+		t.Fatalf("There was an error: %s", err)
+	}
+	if tag, ok := x.Tags["Image Model"]; !ok || tag.Printable != `"Canon PowerShot G2"` {
+		t.Errorf("Expected the model, got %v", tag)
+	}
+	var fe *FormatError
+	if _, err := Decode(bytes.NewReader(b), int64(len(b)), &Options{Strict: true}); !errors.As(err, &fe) {
+		t.Errorf("Expected a *FormatError, got %v", err)
+	}
+}
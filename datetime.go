@@ -0,0 +1,86 @@
+package exif4go
+
+import (
+	"strings"
+	"time"
+)
+
+// captureTimeSources lists the date and time tags by preference, each with the tags
+// holding its sub-second digits and its offset from UTC.
+var captureTimeSources = [][3]string{
+	{"EXIF DateTimeOriginal", "EXIF SubSecTimeOriginal", "EXIF OffsetTimeOriginal"},
+	{"EXIF DateTimeDigitized", "EXIF SubSecTimeDigitized", "EXIF OffsetTimeDigitized"},
+	{"Image DateTime", "EXIF SubSecTime", "EXIF OffsetTime"},
+}
+
+// asciiVal returns the trimmed value of an ASCII tag, empty when the tag is missing.
+func (x *Exif) asciiVal(key string) string {
+	t, ok := x.Tags[key]
+	if !ok {
+		return ""
+	}
+	s, err := t.StringVal()
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(s)
+}
+
+// parseDateTime parses an EXIF date and time, "2010:11:28 16:42:18", with the optional
+// sub-second digits and offset from UTC, "+01:00". Without offset the time is local.
+func parseDateTime(datetime string, subsec string, offset string) (time.Time, error) {
+	loc := time.Local
+	if offset != "" {
+		o, err := time.Parse("-07:00", offset)
+		if err != nil {
+			return time.Time{}, err
+		}
+		_, sec := o.Zone()
+		loc = time.FixedZone(offset, sec)
+	}
+	t, err := time.ParseInLocation("2006:01:02 15:04:05", datetime, loc)
+	if err != nil {
+		return time.Time{}, err
+	}
+	// the digits are the decimal fraction of the second, "5" or "50" are half a second
+	ns := 0
+	for i, c := range subsec {
+		if c < '0' || c > '9' || i >= 9 {
+			break
+		}
+		ns += int(c-'0') * pow10(8-i)
+	}
+	return t.Add(time.Duration(ns)), nil
+}
+
+func pow10(n int) int {
+	p := 1
+	for ; n > 0; n-- {
+		p *= 10
+	}
+	return p
+}
+
+// CaptureTime returns the time the picture was taken and the key of the tag it comes from.
+// DateTimeOriginal is preferred, then DateTimeDigitized and DateTime, skipping missing or
+// blank values such as "0000:00:00 00:00:00". The matching SubSecTime and Exif 2.31 OffsetTime
+// tags are applied; without offset the camera time zone is unknown and the time is returned
+// in the local time zone. It returns ErrNoDateTime when none of the tags holds a valid time.
+func (x *Exif) CaptureTime() (time.Time, string, error) {
+	for _, src := range captureTimeSources {
+		datetime := x.asciiVal(src[0])
+		if datetime == "" {
+			continue
+		}
+		offset := x.asciiVal(src[2])
+		t, err := parseDateTime(datetime, x.asciiVal(src[1]), offset)
+		if err != nil && offset != "" {
+			// ignore a malformed offset rather than the whole date
+			t, err = parseDateTime(datetime, x.asciiVal(src[1]), "")
+		}
+		if err == nil {
+			return t, src[0], nil
+		}
+	}
+	return time.Time{}, "", ErrNoDateTime
+}
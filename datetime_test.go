@@ -0,0 +1,79 @@
+package exif4go
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io/ioutil"
+	"testing"
+	"time"
+)
+
+func TestCaptureTime(t *testing.T) {
+	ts := &TagSet{
+		Image: []*IfdTag{NewASCIITag(0x0132, "2010:11:28 18:00:00")},
+		Exif: []*IfdTag{
+			NewASCIITag(0x9003, "2010:11:28 16:42:18"),
+			NewASCIITag(0x9004, "0000:00:00 00:00:00"),
+			NewASCIITag(0x9011, "+01:00"),
+			NewASCIITag(0x9291, "25"),
+		},
+	}
+	b, err := Encode(ts, binary.LittleEndian)
+	if err != nil {
+		t.Fatalf("Error encoding: %s", err)
+	}
+	x, err := Decode(bytes.NewReader(b), int64(len(b)), nil)
+	if err != nil {
+		t.Fatalf("There was an error: %s", err)
+	}
+	if tag, ok := x.Tags["EXIF OffsetTimeOriginal"]; !ok || tag.Printable != `"+01:00"` {
+		t.Errorf("OffsetTimeOriginal not decoded: %v", tag)
+	}
+	tm, src, err := x.CaptureTime()
+	if err != nil {
+		t.Fatalf("There was an error: %s", err)
+	}
+	want := time.Date(2010, 11, 28, 15, 42, 18, 250000000, time.UTC)
+	if src != "EXIF DateTimeOriginal" || !tm.Equal(want) {
+		t.Errorf("Expected %v from EXIF DateTimeOriginal, got %v from %s", want, tm, src)
+	}
+	if _, off := tm.Zone(); off != 3600 {
+		t.Errorf("Expected a +01:00 zone, got %d seconds", off)
+	}
+
+	// fall back to DateTime, the blank DateTimeDigitized is skipped
+	ts.Exif = ts.Exif[1:]
+	if b, err = Encode(ts, binary.LittleEndian); err != nil {
+		t.Fatalf("Error encoding: %s", err)
+	}
+	if x, err = Decode(bytes.NewReader(b), int64(len(b)), nil); err != nil {
+		t.Fatalf("There was an error: %s", err)
+	}
+	tm, src, err = x.CaptureTime()
+	want = time.Date(2010, 11, 28, 18, 0, 0, 0, time.Local)
+	if err != nil || src != "Image DateTime" || !tm.Equal(want) {
+		t.Errorf("Expected %v from Image DateTime, got %v from %s (%v)", want, tm, src, err)
+	}
+
+	ts.Image = nil
+	if b, err = Encode(ts, binary.LittleEndian); err != nil {
+		t.Fatalf("Error encoding: %s", err)
+	}
+	if x, err = Decode(bytes.NewReader(b), int64(len(b)), nil); err != nil {
+		t.Fatalf("There was an error: %s", err)
+	}
+	if _, _, err := x.CaptureTime(); err != ErrNoDateTime {
+		t.Errorf("Expected ErrNoDateTime, got %v", err)
+	}
+
+	fpath := "./test/test.jpg"
+	if b, err = ioutil.ReadFile(fpath); err != nil {
+		t.Fatal("Error reading file:", fpath)
+	}
+	if x, err = Decode(bytes.NewReader(b), int64(len(b)), nil); err != nil {
+		t.Fatalf("There was an error: %s", err)
+	}
+	if _, src, err := x.CaptureTime(); err != nil || src != "EXIF DateTimeOriginal" {
+		t.Errorf("Expected the time from EXIF DateTimeOriginal, got %s (%v)", src, err)
+	}
+}
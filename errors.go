@@ -0,0 +1,88 @@
+package exif4go
+
+import (
+	"errors"
+	"fmt"
+	"io"
+)
+
+var (
+	// ErrNoExif is returned when the image format is recognized but it carries no EXIF information.
+	ErrNoExif = errors.New("no EXIF information found")
+	// ErrUnknownFormat is returned when the file is not in one of the supported image formats.
+	ErrUnknownFormat = errors.New("unknown file format")
+	// ErrTruncated is returned when the EXIF information ends before the data it describes.
+	ErrTruncated = errors.New("truncated EXIF data")
+	// ErrInvalidOffset is returned when an offset points outside of the image.
+	ErrInvalidOffset = errors.New("invalid offset")
+	// ErrNoThumbnail is returned when the EXIF information holds no thumbnail image.
+	ErrNoThumbnail = errors.New("no thumbnail found")
+	// ErrNoPreview is returned when the file holds no embedded preview image.
+	ErrNoPreview = errors.New("no preview image found")
+	// ErrNoLocation is returned when the EXIF information holds no GPS coordinates.
+	ErrNoLocation = errors.New("no GPS location found")
+	// ErrNoDateTime is returned when the EXIF information holds no valid date and time.
+	ErrNoDateTime = errors.New("no date and time found")
+	// ErrBrotli is returned for JPEG XL images whose EXIF information is Brotli compressed, which is not supported.
+	ErrBrotli = errors.New("Brotli compressed EXIF information not supported")
+
+	// ErrTagType is returned by the IfdTag accessors when the field type does not hold the requested kind of value.
+	ErrTagType = errors.New("tag field type does not match the requested value")
+	// ErrValueIndex is returned by the IfdTag accessors when the requested item is not present.
+	ErrValueIndex = errors.New("tag value index out of range")
+)
+
+// FormatError records where the parsing of malformed EXIF information failed.
+// Err is usually one of ErrTruncated or ErrInvalidOffset and can be tested with errors.Is.
+type FormatError struct {
+	// name of the IFD being processed, empty outside of an IFD
+	Ifd string
+	// ID of the tag being processed, -1 outside of a tag entry
+	Tag int
+	// absolute byte offset in the image of the failed read
+	Offset int64
+	// the underlying error
+	Err error
+}
+
+func (e *FormatError) Error() string {
+	s := ""
+	if e.Ifd != "" {
+		s += fmt.Sprintf("IFD %s, ", e.Ifd)
+	}
+	if e.Tag >= 0 {
+		s += fmt.Sprintf("tag 0x%04X, ", e.Tag)
+	}
+	return s + fmt.Sprintf("offset %d: %v", e.Offset, e.Err)
+}
+
+func (e *FormatError) Unwrap() error {
+	return e.Err
+}
+
+// newFormatError returns the error of a failed read at the absolute offset of an image of the given size.
+func newFormatError(err error, offset int64, length int64, size int64) *FormatError {
+	switch {
+	case offset < 0 || offset >= size:
+		err = ErrInvalidOffset
+	case err == io.EOF || err == io.ErrUnexpectedEOF || offset+length > size:
+		err = ErrTruncated
+	}
+	return &FormatError{Tag: -1, Offset: offset, Err: err}
+}
+
+// inIfd fills in the IFD name and tag ID of a FormatError raised while processing an IFD entry,
+// any other error is wrapped in a FormatError at the given offset.
+func inIfd(err error, ifdname string, tag int, offset int64) error {
+	fe, ok := err.(*FormatError)
+	if !ok {
+		return &FormatError{ifdname, tag, offset, err}
+	}
+	if fe.Ifd == "" {
+		fe.Ifd = ifdname
+	}
+	if fe.Tag < 0 {
+		fe.Tag = tag
+	}
+	return fe
+}
@@ -3,24 +3,76 @@ package exif4go
 import (
 	"fmt"
 	"io"
+	"log"
 	"os"
-	"strconv"
 )
 
-var detailed bool
-var debug bool
+// Default limits used when the corresponding Options field is zero.
+const (
+	defaultMaxValues = 1000
+	defaultMaxIfds   = 100
+)
 
-func setDebug(deb bool) {
-	debug = deb
+// Options controls how an image is decoded.
+// The zero value processes all the tags except MakerNote and UserComment, is not strict and does not log.
+// Options are only read while decoding, so the same value can be shared by concurrent calls.
+type Options struct {
+	// stop processing an IFD after the tag with this name, "UNDEF" or empty to process all tags
+	StopTag string
+	// also process the slow MakerNote and UserComment tags
+	Details bool
+	// return an error instead of skipping tags of unknown field type and malformed sub IFDs or thumbnails
+	Strict bool
+	// destination of the debug output, nil to disable it
+	Logger *log.Logger
+	// tags with more data items are kept without values (MakerNote excluded), 0 means 1000,
+	// single values are always decoded
+	MaxValues int
+	// maximum number of IFDs followed in the IFD chain, 0 means 100
+	MaxIfds int
 }
 
-func writeInfo(a ...interface{}) (n int, err error) {
+// newOptions returns the options of the legacy ProcessFile parameters, debug output goes to the standard output.
+func newOptions(stop_tag string, details bool, strict bool, debug bool) *Options {
+	o := &Options{StopTag: stop_tag, Details: details, Strict: strict}
 	if debug {
-		if n, err = fmt.Println(a...); err != nil {
-			print("Error printing")
-		}
+		o.Logger = log.New(os.Stdout, "", 0)
+	}
+	return o
+}
+
+// withDefaults returns a copy of the options with the unset fields filled in.
+func (o *Options) withDefaults() *Options {
+	c := Options{}
+	if o != nil {
+		c = *o
+	}
+	// yah it"s cheesy...
+	if len(c.StopTag) == 0 {
+		c.StopTag = "UNDEF"
+	}
+	if c.MaxValues <= 0 {
+		c.MaxValues = defaultMaxValues
+	}
+	if c.MaxIfds <= 0 {
+		c.MaxIfds = defaultMaxIfds
+	}
+	return &c
+}
+
+// tolerate logs and drops an error affecting only part of the tags, unless in strict mode.
+func (o *Options) tolerate(err error) error {
+	if err == nil || o.Strict {
+		return err
+	}
+	o.writeInfo("Skipping malformed data:", err)
+	return nil
+}
+
+func (o *Options) writeInfo(a ...interface{}) {
+	if o.Logger != nil {
+		o.Logger.Println(a...)
 	}
-	return
 }
 
 type StringSlice []string
@@ -45,107 +97,201 @@ func (p IntSlice) contains(i int) bool {
 	return false
 }
 
+// Exif holds the EXIF information decoded from an image.
+type Exif struct {
+	// tags keyed by IFD and tag name, e.g. "Image Make" or "EXIF DateTimeOriginal": the tags of
+	// the IFDs listed by IfdList that the package knows, with the tags derived from them
+	Tags map[string]*IfdTag
+	// the main IFD chain, IFD0 first, each IFD holding the IFDs it points to, or the "CIFF" IFD
+	// of a CRW file
+	Ifds []*Ifd
+	// file format: "JPEG", "PNG", "HEIF", "WebP", "JPEG XL", "TIFF", "BigTIFF", one of the TIFF based
+	// RAW formats "CR2", "NEF", "ARW", "DNG", "PEF", "ORF" and "RW2", "RAF" or "CRW"
+	Format string
+	// the decoded TIFF structure, to read the embedded images on demand
+	hdr *exifHeader
+	// the JPEG image embedded in a RAW container, which is its own preview
+	embedded *io.SectionReader
+	// JPEG thumbnail data
+	thumbnail []byte
+	// offset of IFD1 when it describes an uncompressed thumbnail
+	thumbifd int
+}
+
+// Thumbnail returns the JPEG thumbnail referenced by IFD1, or found in the MakerNote,
+// without decoding the full image. An uncompressed thumbnail is returned as a standalone
+// TIFF file holding its strips, built on each call. It returns ErrNoThumbnail when there is none.
+func (x *Exif) Thumbnail() ([]byte, error) {
+	if x.thumbnail == nil && x.thumbifd > 0 {
+		return x.hdr.extractTiffThumbnail(x.thumbifd)
+	}
+	if x.thumbnail == nil {
+		return nil, ErrNoThumbnail
+	}
+	return x.thumbnail, nil
+}
+
 // Process process an images file calling the ProcessFile function with default parameters.
 func Process(f *os.File, debug bool) (map[string]*IfdTag, error) {
-	writeInfo("Processing using default parameters")
 	return ProcessFile(f, "UNDEF", true, false, debug)
 }
 
-/* 
-	ProcessFile processes an image file (expects an open file object). 
-	This is the function that has to deal with all the arbitrary nasty bits of the EXIF standard.
+/*
+	ProcessFile processes an image file (expects an open file object).
+	It is a thin wrapper around Decode using the file size reported by Stat.
 */
 func ProcessFile(f *os.File, stop_tag string, details bool, strict bool, debug bool) (map[string]*IfdTag, error) {
-	// yah it"s cheesy...
-	if len(stop_tag) == 0 {
-		stop_tag = "UNDEF"
+	fi, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	x, err := Decode(f, fi.Size(), newOptions(stop_tag, details, strict, debug))
+	if err != nil {
+		return nil, err
 	}
-	//global detailed
-	detailed = details
+	return x.Tags, nil
+}
+
+/*
+	Decode processes an image of the given size read through r, e.g. an open file,
+	a bytes.Reader or any other io.ReaderAt, using the given options (nil for the defaults).
+	TIFF, JPEG, PNG (eXIf chunk or legacy raw profile text chunk), HEIF, HEIC, AVIF, WebP
+	and JPEG XL images are supported, as well as the TIFF based RAW formats, Fujifilm RAF
+	and Canon CRW files.
+	It is safe to call Decode from several goroutines at once.
+	It returns ErrUnknownFormat for unsupported files, ErrNoExif for images without EXIF information
+	and a *FormatError locating the problem in malformed EXIF information.
+	This is the function that has to deal with all the arbitrary nasty bits of the EXIF standard.
+*/
+func Decode(r io.ReaderAt, size int64, opts *Options) (*Exif, error) {
+	o := opts.withDefaults()
+
+	// never read past the end of the image
+	sr := io.NewSectionReader(r, 0, size)
 
 	// by default do not fake an EXIF beginning
 	//fake_exif := 0
 
 	// determine whether it"s a JPEG or TIFF
 	data := make([]byte, 12)
-	_, err := io.ReadAtLeast(f, data, 12)
-	if err != nil {
-		return nil, err
+	if _, err := sr.ReadAt(data, 0); err != nil {
+		// too short to be identified
+		return nil, ErrUnknownFormat
 	}
 
-	writeInfo("data has value:", data)
+	o.writeInfo("data has value:", data)
 
-	s := StringSlice{"II*\x00", "MM\x00*"}
+	// TIFF and the RAW formats with their own magic number: Olympus ORF and Panasonic RW2
+	s := StringSlice{"II*\x00", "MM\x00*", "IIRO", "IIRS", "MMOR", "IIU\x00"}
+	var format string
+	// the reader holding the TIFF structure, the image unless it is decoded in memory
+	var src io.ReaderAt = sr
 	var offset int64
 	var endian []byte
-	var fakeexif bool
 
 	switch {
+	case string(data[0:4]) == "II+\x00" || string(data[0:4]) == "MM\x00+":
+		// it's a BigTIFF file
+		o.writeInfo("BigTIFF file")
+		format = "BigTIFF"
+		endian = data[0:1]
+		offset = 0
 	case s.contains(string(data[0:4])):
 		// it"s a TIFF file
-		writeInfo("TIFF file")
-		f.Seek(0, 0) // 0 relative to the beginning of the file
-		endian = make([]byte, 1)
-		if _, err := io.ReadAtLeast(f, endian, 1); err != nil {
-			return nil, err
-		}
-		io.ReadAtLeast(f, endian, 1) // read again
+		o.writeInfo("TIFF file")
+		format = "TIFF"
+		endian = data[0:1]
 		offset = 0
 	case string(data[0:2]) == "\xFF\xD8":
 		// it's a JPEG file
-		writeInfo("JPEG file")
-		s := StringSlice{"JFIF", "JFXX", "OLYM", "Phot"}
-
-		token := string(data[6:10])
-		for ; data[2] == 0xFF && s.contains(token); token = string(data[6:10]) {
-			writeInfo("String token data[6:10]:", token)
-			length := int(data[4])*256 + int(data[5])
-			jump := make([]byte, length-8)
-			//f.Read(jump) // advance
-			//writeInfo("The string value of jump is:", string(jump))
-			f.Seek(int64(length-8), 1) // advance relative to the current offset
-
-			jump = make([]byte, 10)
-			if _, err := f.Read(jump); err != nil {
+		o.writeInfo("JPEG file")
+		format = "JPEG"
+		var err error
+		if offset, err = jpegExif(sr, size); err != nil {
+			if err == ErrNoExif {
 				return nil, err
 			}
-
-			sj := string(jump)
-			writeInfo("The string value of jump is:", sj)
-			data = []byte("\xFF\x00" + sj)
-			fakeexif = true
-		}
-		writeInfo("fakeexif:", fakeexif)
-
-		if data[2] == 0xFF && string(data[6:10]) == "Exif" {
-			//detected EXIF header
-			writeInfo("detected EXIF header")
-			offset, _ = f.Seek(0, 1)
-			endian = make([]byte, 1)
-			if _, err := f.Read(endian); err != nil {
+			// a malformed segment before any Exif one
+			if err := o.tolerate(err); err != nil {
 				return nil, err
 			}
-		} else {
-			// no EXIF information
-			return nil, nil
+			return nil, ErrNoExif
+		}
+		o.writeInfo("detected EXIF header")
+	case string(data[0:12]) == rafSignature[0:12]:
+		// it's a Fujifilm RAF file
+		o.writeInfo("RAF file")
+		return rafDecode(sr, size, o)
+	case isCiff(sr):
+		// it's a Canon CRW file
+		o.writeInfo("CRW file")
+		return ciffDecode(sr, size, o)
+	case string(data[0:8]) == pngSignature:
+		// it's a PNG file
+		o.writeInfo("PNG file")
+		format = "PNG"
+		var err error
+		if src, size, offset, err = pngExif(sr, size); err != nil {
+			return nil, err
+		}
+	case string(data[0:12]) == jxlSignature:
+		// it's a JPEG XL file
+		o.writeInfo("JPEG XL file")
+		format = "JPEG XL"
+		var err error
+		if src, size, offset, err = jxlExif(sr, size); err != nil {
+			return nil, err
+		}
+	case string(data[0:2]) == "\xFF\x0A":
+		// a bare JPEG XL codestream has no room for EXIF information
+		return nil, ErrNoExif
+	case string(data[4:8]) == "ftyp" && isHeif(sr, size):
+		// it's a HEIF, HEIC or AVIF file
+		o.writeInfo("HEIF file")
+		format = "HEIF"
+		var err error
+		if src, size, offset, err = heifExif(sr, size); err != nil {
+			return nil, err
+		}
+	case string(data[0:4]) == "RIFF" && string(data[8:12]) == "WEBP":
+		// it's a WebP file
+		o.writeInfo("WebP file")
+		format = "WebP"
+		var err error
+		if src, size, offset, err = webpExif(sr, size); err != nil {
+			return nil, err
 		}
 	default:
 		// file format not recognized
-		return nil, nil
+		return nil, ErrUnknownFormat
+	}
+	if endian == nil {
+		// the TIFF header found in a container starts with the byte order
+		endian = make([]byte, 1)
+		if _, err := src.ReadAt(endian, offset); err != nil {
+			return nil, newFormatError(err, offset, 1, size)
+		}
 	}
 	// deal with the EXIF info we found
-	writeInfo("The offset is:", offset, "\nThe endian value is:", string(endian), ", where 'I' => 'Intel', 'M' => 'Motorola'")
+	o.writeInfo("The offset is:", offset, "\nThe endian value is:", string(endian), ", where 'I' => 'Intel', 'M' => 'Motorola'")
 
-	hdr := newExifHeader(f, endian, offset, fakeexif, strict, debug)
+	hdr := newExifHeader(src, size, endian, offset, o)
+	hdr.bigTiff = format == "BigTIFF"
 	ifdlist, err := hdr.listIfds()
 	if err != nil {
 		return nil, err
 	}
-	writeInfo("The length of ifdlist is:", len(ifdlist))
-	var ctr int
-	for _, i := range ifdlist {
-		var ifdname string
-		var thumbifd int
+	o.writeInfo("The length of ifdlist is:", len(ifdlist))
+	dict := exifTags
+	if string(data[0:4]) == "IIU\x00" {
+		dict = panasonicRawTags
+	}
+	walker := newIfdWalker(hdr)
+	var ifds []*Ifd
+	// offset of IFD1, describing the thumbnail
+	var thumbifd int
+	for ctr, i := range ifdlist {
+		var ifdname, prefix string
 		switch {
 		case ctr == 0:
 			ifdname = "Image"
@@ -155,82 +301,92 @@ func ProcessFile(f *os.File, stop_tag string, details bool, strict bool, debug b
 		default:
 			ifdname = fmt.Sprintf("IFD %d", ctr)
 		}
-		writeInfo(fmt.Sprintf(" IFD %d (%s) at offset %d:", ctr, ifdname, i))
-
-		hdr.dumpIfd(i, ifdname, exifTags, 0, stop_tag)
-
-		if exifoff, ok := hdr.tags[ifdname+" ExifOffset"]; ok {
-			writeInfo(fmt.Sprintf(" EXIF SubIFD at offset %d:", exifoff.Values[0]))
-			v, _ := strconv.Atoi(exifoff.Values[0])
-			hdr.dumpIfd(v, "EXIF", exifTags, 0, stop_tag)
-
-			// Interoperability IFD contained in EXIF IFD
-			if introff, ok := hdr.tags["EXIF SubIFD InteroperabilityOffset"]; ok {
-				writeInfo(fmt.Sprintf(" EXIF Interoperability SubSubIFD at offset %d:", introff.Values[0]))
-				v, _ := strconv.Atoi(introff.Values[0])
-				hdr.dumpIfd(v, "EXIF Interoperability", interTags, 0, stop_tag)
-			}
-
+		if ctr > 0 {
+			// the EXIF, GPS and Interoperability IFDs of the other IFDs
+			prefix = ifdname + " "
 		}
+		o.writeInfo(fmt.Sprintf(" IFD %d (%s) at offset %d:", ctr, ifdname, i))
 
-		// GPS IFD
-		if gpsoff, ok := hdr.tags[ifdname+" GPSInfo"]; ok {
-			writeInfo(fmt.Sprintf(" GPS SubIFD at offset %d:", gpsoff.Values[0]))
-			v, _ := strconv.Atoi(gpsoff.Values[0])
-			hdr.dumpIfd(v, "GPS", gpsTags, 0, stop_tag)
-			//hdr.dump_IFD(gps_off.values[0], 'GPS', dict = GPS_TAGS, stop_tag = stop_tag)
+		ifd, err := walker.walk(i, ifdname, prefix, dict, 0)
+		if err != nil {
+			return nil, err
+		}
+		if ifd != nil {
+			ifds = append(ifds, ifd)
 		}
-		writeInfo("thumbifd:", thumbifd)
-		ctr += 1
+		o.writeInfo("thumbifd:", thumbifd)
+	}
 
+	if format == "TIFF" {
+		format = rawFormat(data, hdr.tags)
 	}
+	x := &Exif{Tags: hdr.tags, Format: format, Ifds: ifds, hdr: hdr}
 
-	// extract uncompressed TIFF thumbnail
-	thumb, ok := hdr.tags["Thumbnail Compression"]
-	if ok && thumb.Printable == "Uncompressed TIFF" {
-		//hdr.extract_TIFF_thumbnail(thumb_ifd)
+	// uncompressed TIFF thumbnail, extracted by Thumbnail
+	if thumb, ok := hdr.tags["Thumbnail Compression"]; ok && thumbifd > 0 && hdr.isThumbnailIfd() {
+		if c, err := thumb.Int(0); err == nil && c == 1 {
+			x.thumbifd = thumbifd
+		}
 	}
 
 	//JPEG thumbnail (thankfully the JPEG data is stored as a unit)
-	if thumboff, ok := hdr.tags["Thumbnail JPEGInterchangeFormat"]; ok {
-		j, _ := strconv.Atoi(thumboff.Values[0])
-		f.Seek(offset+int64(j), 0)
-		size, _ := strconv.Atoi(hdr.tags["Thumbnail JPEGInterchangeFormatLength"].Values[0])
-		t := make([]byte, size)
-		n, err := f.Read(t)
-		if err != nil {
+	thumboff, ok1 := hdr.tags["Thumbnail JPEGInterchangeFormat"]
+	thumblen, ok2 := hdr.tags["Thumbnail JPEGInterchangeFormatLength"]
+	if ok1 && ok2 {
+		var t []byte
+		j, err := hdr.tagInt(thumboff)
+		if err == nil {
+			var size int
+			if size, err = hdr.tagInt(thumblen); err == nil {
+				t, err = hdr.readBytes(j, size)
+			}
+		}
+		if err := o.tolerate(err); err != nil {
 			return nil, err
 		}
-		writeInfo("Return number of bytes:", n)
-		// hdr.tags["JPEGThumbnail"] = string(t) why this
+		o.writeInfo("Return number of bytes:", len(t))
+		if t != nil {
+			x.thumbnail = t
+		}
 	}
 
 	// deal with MakerNote contained in EXIF IFD
 	// (Some apps use MakerNote tags but do not use a format for which we
 	// have a description, do not process these).
 
-	_, ok1 := hdr.tags["EXIF MakerNote"]
-	_, ok2 := hdr.tags["Image Make"]
-	if ok1 && ok2 && detailed {
-		//hdr.decode_maker_note()
+	_, ok1 = hdr.tags["EXIF MakerNote"]
+	_, ok2 = hdr.tags["Image Make"]
+	if ok1 && ok2 && o.Details {
+		note, err := hdr.decodeMakerNote()
+		if err := o.tolerate(err); err != nil {
+			return nil, err
+		}
+		// the MakerNote IFD is a child of the EXIF IFD holding the MakerNote tag
+		for _, ifd := range x.IfdList() {
+			if note != nil && ifd.Name == "EXIF" {
+				ifd.Children = append(ifd.Children, note)
+				break
+			}
+		}
 	}
 
 	// Sometimes in a TIFF file, a JPEG thumbnail is hidden in the MakerNote
 	// since it's not allowed in a uncompressed TIFF IFD
-	if _, ok := hdr.tags["JPEGThumbnail"]; !ok {
+	if x.thumbnail == nil && x.thumbifd == 0 {
 
 		if thumboff, ok := hdr.tags["MakerNote JPEGThumbnail"]; ok {
-			j, _ := strconv.Atoi(thumboff.Values[0])
-			f.Seek(offset+int64(j), 0)
-			t := make([]byte, thumboff.fieldlength)
-			n, err := f.Read(t)
-			if err != nil {
+			var t []byte
+			j, err := hdr.tagInt(thumboff)
+			if err == nil {
+				t, err = hdr.readBytes(j, thumboff.fieldlength)
+			}
+			if err := o.tolerate(err); err != nil {
 				return nil, err
 			}
-			writeInfo("Return number of bytes:", n)
-			// hdr.tags["JPEGThumbnail"] = t why this
+			o.writeInfo("Return number of bytes:", len(t))
+			x.thumbnail = t
 		}
 	}
-	return hdr.tags, nil
+	return x, nil
 
 }
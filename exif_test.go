@@ -1,8 +1,15 @@
 package exif4go
 
 import (
-	"testing"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io/ioutil"
+	"math/big"
 	"os"
+	"strings"
+	"sync"
+	"testing"
 )
 
 func TestProcessFile(t *testing.T) {
@@ -46,3 +53,484 @@ func TestProcessFile(t *testing.T) {
 	checker("EXIF DateTimeOriginal", "EXIF DateTimeOriginal", "2010:11:28 16:42:18")
 
 }
+
+func TestDecodeReaderAt(t *testing.T) {
+	fpath := "./test/test.jpg"
+	b, err := ioutil.ReadFile(fpath)
+	if err != nil {
+		t.Fatal("Error reading file:", fpath)
+	}
+	x, err := Decode(bytes.NewReader(b), int64(len(b)), &Options{Details: true})
+	if err != nil {
+		t.Fatalf("There was an error: %s", err)
+	}
+	tags := x.Tags
+	if x.Format != "JPEG" {
+		t.Errorf("Expected the JPEG format, got %s", x.Format)
+	}
+
+	f, err := os.Open(fpath)
+	if err != nil {
+		t.Fatal("Error opening file:", fpath)
+	}
+	defer f.Close()
+	ftags, err := Process(f, false)
+	if err != nil {
+		t.Fatalf("There was an error: %s", err)
+	}
+
+	if len(tags) != len(ftags) {
+		t.Errorf("Decoded %d tags from memory but %d from the file", len(tags), len(ftags))
+	}
+	for k, ftag := range ftags {
+		if tag, ok := tags[k]; !ok {
+			t.Errorf("The key %s is missing", k)
+		} else if tag.Printable != ftag.Printable {
+			t.Errorf("The value of %s is %s, expected %s", k, tag.Printable, ftag.Printable)
+		}
+	}
+
+	// a truncated image must not be read past its end
+	if _, err := Decode(bytes.NewReader(b), 4, nil); err == nil {
+		t.Error("Expected an error decoding a truncated image")
+	}
+}
+
+func TestTypedValues(t *testing.T) {
+	fpath := "./test/test.jpg"
+	f, err := os.Open(fpath)
+	if err != nil {
+		t.Fatal("Error opening file:", fpath)
+	}
+	defer f.Close()
+	tags, err := Process(f, false)
+	if err != nil {
+		t.Fatalf("There was an error: %s", err)
+	}
+
+	if v, err := tags["EXIF ExifImageWidth"].Int(0); err != nil || v != 3888 {
+		t.Errorf("ExifImageWidth is %d (%v), expected 3888", v, err)
+	}
+	if v, err := tags["EXIF ISOSpeedRatings"].Uint(0); err != nil || v != 100 {
+		t.Errorf("ISOSpeedRatings is %d (%v), expected 100", v, err)
+	}
+	if num, den, err := tags["EXIF ExposureTime"].Rat2(0); err != nil || num != 1 || den != 40 {
+		t.Errorf("ExposureTime is %d/%d (%v), expected 1/40", num, den, err)
+	}
+	if r, err := tags["EXIF FNumber"].Rat(0); err != nil || r.Cmp(big.NewRat(28, 5)) != 0 {
+		t.Errorf("FNumber is %v (%v), expected 28/5", r, err)
+	}
+	if v, err := tags["EXIF FNumber"].Float(0); err != nil || v != 5.6 {
+		t.Errorf("FNumber is %v (%v), expected 5.6", v, err)
+	}
+	if s, err := tags["Image Model"].StringVal(); err != nil || s != "Canon EOS 1000D" {
+		t.Errorf("Model is %q (%v), expected Canon EOS 1000D", s, err)
+	}
+	if b := tags["EXIF ExifVersion"].Bytes(); string(b) != "0221" {
+		t.Errorf("ExifVersion is %q, expected 0221", b)
+	}
+
+	if _, err := tags["Image Model"].Int(0); err != ErrTagType {
+		t.Errorf("Expected ErrTagType reading an ASCII tag as integer, got %v", err)
+	}
+	if _, err := tags["EXIF ExifImageWidth"].Int(1); err != ErrValueIndex {
+		t.Errorf("Expected ErrValueIndex reading past the last item, got %v", err)
+	}
+}
+
+// TestConcurrentDecode decodes the same image with different options from several goroutines,
+// run it with "go test -race" to check that no state is shared between calls.
+func TestConcurrentDecode(t *testing.T) {
+	fpath := "./test/test.jpg"
+	b, err := ioutil.ReadFile(fpath)
+	if err != nil {
+		t.Fatal("Error reading file:", fpath)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 16; i++ {
+		wg.Add(1)
+		go func(details bool) {
+			defer wg.Done()
+			opts := &Options{Details: details}
+			if !details {
+				opts.StopTag = "Model"
+			}
+			x, err := Decode(bytes.NewReader(b), int64(len(b)), opts)
+			if err != nil {
+				t.Errorf("There was an error: %s", err)
+				return
+			}
+			tags := x.Tags
+			if _, ok := tags["EXIF MakerNote"]; ok != details {
+				t.Errorf("MakerNote present: %v, with details: %v", ok, details)
+			}
+			if _, ok := tags["Image Orientation"]; ok != details {
+				t.Errorf("Orientation present: %v, with stop tag: %q", ok, opts.StopTag)
+			}
+		}(i%2 == 0)
+	}
+	wg.Wait()
+}
+
+func TestDecodeErrors(t *testing.T) {
+	if _, err := Decode(strings.NewReader("not an image file"), 17, nil); err != ErrUnknownFormat {
+		t.Errorf("Expected ErrUnknownFormat, got %v", err)
+	}
+	jpeg := "\xFF\xD8\xFF\xDB\x00\x43\x00\x10\x0B\x0C\x0E\x0C"
+	if _, err := Decode(strings.NewReader(jpeg), int64(len(jpeg)), nil); err != ErrNoExif {
+		t.Errorf("Expected ErrNoExif, got %v", err)
+	}
+
+	fpath := "./test/test.jpg"
+	b, err := ioutil.ReadFile(fpath)
+	if err != nil {
+		t.Fatal("Error reading file:", fpath)
+	}
+	for _, size := range []int64{100, 1000, 9000} {
+		_, err = Decode(bytes.NewReader(b), size, &Options{Strict: true})
+		var fe *FormatError
+		if !errors.As(err, &fe) {
+			t.Errorf("Expected a *FormatError for an image truncated at %d, got %v", size, err)
+			continue
+		}
+		if !errors.Is(err, ErrTruncated) && !errors.Is(err, ErrInvalidOffset) {
+			t.Errorf("Expected ErrTruncated or ErrInvalidOffset, got %v", fe.Err)
+		}
+		if errors.Is(err, ErrTruncated) && fe.Offset >= size {
+			t.Errorf("The truncated read at offset %d is outside of the image of size %d", fe.Offset, size)
+		}
+	}
+
+	// a thumbnail of length -1
+	length := NewLongTag(0x0202, 0xFFFFFFFF)
+	length.Fieldtype = 9
+	ifd0 := []*IfdTag{NewASCIITag(0x010F, "Ca")}
+	ifd1 := []*IfdTag{NewLongTag(0x0201, 8), length}
+	b = make([]byte, 8+ifdSize(ifd0)+ifdSize(ifd1))
+	copy(b, "II*\x00")
+	binary.LittleEndian.PutUint32(b[4:], 8)
+	writeIfd(b, 8, ifd0, 8+ifdSize(ifd0), binary.LittleEndian)
+	writeIfd(b, 8+ifdSize(ifd0), ifd1, 0, binary.LittleEndian)
+	if _, err := Decode(bytes.NewReader(b), int64(len(b)), &Options{Strict: true}); !errors.Is(err, ErrInvalidOffset) {
+		t.Errorf("Expected ErrInvalidOffset for a negative thumbnail length, got %v", err)
+	}
+	x, err := Decode(bytes.NewReader(b), int64(len(b)), nil)
+	if err != nil {
+		t.Fatalf("There was an error: %s", err)
+	}
+	if _, err := x.Thumbnail(); err != ErrNoThumbnail {
+		t.Errorf("Expected ErrNoThumbnail, got %v", err)
+	}
+}
+
+func TestMaxValues(t *testing.T) {
+	fpath := "./test/test.jpg"
+	b, err := ioutil.ReadFile(fpath)
+	if err != nil {
+		t.Fatal("Error reading file:", fpath)
+	}
+	for _, max := range []int{1, 2, 3} {
+		x, err := Decode(bytes.NewReader(b), int64(len(b)), &Options{Details: true, MaxValues: max})
+		if err != nil {
+			t.Fatalf("There was an error with %d values: %s", max, err)
+		}
+		if tag, ok := x.Tags["EXIF ExifImageWidth"]; !ok || tag.Printable != "3888" {
+			t.Errorf("Expected the 3888 width with %d values, got %v", max, tag)
+		}
+		for k, tag := range x.Tags {
+			if tag.Count() > max && len(tag.Values) > 0 && !isStringType(tag.Fieldtype) && !strings.Contains(k, "MakerNote") {
+				t.Errorf("Unexpected values of %s with %d values: %v", k, max, tag.Values)
+			}
+		}
+	}
+}
+
+func TestThumbnail(t *testing.T) {
+	fpath := "./test/test.jpg"
+	b, err := ioutil.ReadFile(fpath)
+	if err != nil {
+		t.Fatal("Error reading file:", fpath)
+	}
+	x, err := Decode(bytes.NewReader(b), int64(len(b)), nil)
+	if err != nil {
+		t.Fatalf("There was an error: %s", err)
+	}
+	thumb, err := x.Thumbnail()
+	if err != nil {
+		t.Fatalf("There was an error: %s", err)
+	}
+	if len(thumb) != 7320 || !bytes.HasPrefix(thumb, []byte("\xFF\xD8")) || !bytes.HasSuffix(thumb, []byte("\xFF\xD9")) {
+		t.Errorf("Expected a 7320 bytes JPEG thumbnail, got %d bytes", len(thumb))
+	}
+
+	// an EXIF block without IFD1
+	ts := &TagSet{Image: []*IfdTag{NewASCIITag(0x010F, "Canon")}}
+	blob, err := Encode(ts, binary.LittleEndian)
+	if err != nil {
+		t.Fatalf("Error encoding: %s", err)
+	}
+	if x, err = Decode(bytes.NewReader(blob), int64(len(blob)), nil); err != nil {
+		t.Fatalf("There was an error: %s", err)
+	}
+	if _, err := x.Thumbnail(); err != ErrNoThumbnail {
+		t.Errorf("Expected ErrNoThumbnail, got %v", err)
+	}
+}
+
+func TestExif30Tags(t *testing.T) {
+	utf8 := []byte("Jürgen\x00")
+	ts := &TagSet{
+		Image: []*IfdTag{NewASCIITag(0x010F, "Canon")},
+		Exif: []*IfdTag{
+			NewASCIITag(0xA434, "EF-S18-55mm f/3.5-5.6"),
+			NewRatioTag(0xA432, 18, 1, 55, 1, 35, 10, 56, 10),
+			NewShortTag(0x8830, 2),
+			NewLongTag(0x8832, 400),
+			NewShortTag(0xA460, 2),
+			newTag(0xA437, 129, len(utf8), utf8, binary.BigEndian),
+		},
+		GPS: []*IfdTag{NewShortTag(0x001E, 1)},
+	}
+	b, err := Encode(ts, binary.LittleEndian)
+	if err != nil {
+		t.Fatalf("Error encoding: %s", err)
+	}
+	x, err := Decode(bytes.NewReader(b), int64(len(b)), nil)
+	if err != nil {
+		t.Fatalf("There was an error: %s", err)
+	}
+	expected := map[string]string{
+		"EXIF LensModel":                `"EF-S18-55mm f/3.5-5.6"`,
+		"EXIF LensSpecification":        "18, 55, 7/2, 28/5",
+		"EXIF SensitivityType":          "Recommended Exposure Index",
+		"EXIF RecommendedExposureIndex": "400",
+		"EXIF CompositeImage":           "General Composite Image",
+		"EXIF Photographer":             `"Jürgen"`,
+		"GPS GPSDifferential":           "Differential Correction Applied",
+	}
+	for k, v := range expected {
+		if tag, ok := x.Tags[k]; !ok || tag.Printable != v {
+			t.Errorf("Expected %s to be %s, got %v", k, v, tag)
+		}
+	}
+	if s, err := x.Tags["EXIF Photographer"].StringVal(); err != nil || s != "Jürgen" {
+		t.Errorf("Expected the UTF-8 value Jürgen, got %q (%v)", s, err)
+	}
+	if ft := FieldTypeOf(129); ft == nil || ft.Name != "UTF-8" {
+		t.Errorf("Expected the UTF-8 field type, got %v", ft)
+	}
+
+	// a tag of an unknown type
+	tag := &IfdTag{tag: 0xA437, Fieldtype: 15, count: 1, raw: []byte{1}}
+	if s := tag.String(); !strings.Contains(s, "Unknown") {
+		t.Errorf("Expected an unknown type, got %s", s)
+	}
+	if _, err := tag.Int(0); err == nil {
+		t.Errorf("Expected an error for the unknown type")
+	}
+}
+
+func TestFloatTypes(t *testing.T) {
+	for _, order := range []binary.ByteOrder{binary.LittleEndian, binary.BigEndian} {
+		ts := &TagSet{
+			Image: []*IfdTag{
+				NewFloatTag(0x011A, 72.5, -0.25),
+				NewDoubleTag(0x011B, 1.0/3),
+				newTag(0x0100, 13, 1, []byte{0, 0, 1, 0}, binary.BigEndian),
+			},
+		}
+		b, err := Encode(ts, order)
+		if err != nil {
+			t.Fatalf("Error encoding: %s", err)
+		}
+		x, err := Decode(bytes.NewReader(b), int64(len(b)), &Options{Strict: true})
+		if err != nil {
+			t.Fatalf("There was an error: %s", err)
+		}
+		xres, yres, ifd := x.Tags["Image XResolution"], x.Tags["Image YResolution"], x.Tags["Image ImageWidth"]
+		if xres == nil || yres == nil || ifd == nil {
+			t.Fatalf("Missing tags in the %v block: %v", order, x.Tags)
+		}
+		if xres.Printable != "72.5, -0.25" || yres.Printable != "0.3333333333333333" || ifd.Printable != "256" {
+			t.Errorf("Unexpected values in the %v block: %s; %s; %s", order, xres, yres, ifd)
+		}
+		if v, err := xres.Float(1); err != nil || v != -0.25 {
+			t.Errorf("Expected -0.25, got %v (%v)", v, err)
+		}
+		if v, err := yres.Float(0); err != nil || v != 1.0/3 {
+			t.Errorf("Expected 1/3, got %v (%v)", v, err)
+		}
+		if v, err := ifd.Uint(0); err != nil || v != 256 {
+			t.Errorf("Expected 256, got %v (%v)", v, err)
+		}
+	}
+}
+
+// bigTiff builds a BigTIFF file: IFD0 with Make, a Long8 ImageWidth and the EXIF IFD pointer,
+// the EXIF IFD with an inlined ExposureTime and an out of line DateTimeOriginal.
+func bigTiff(order binary.ByteOrder) []byte {
+	var b []byte
+	put := func(n int, v uint64) {
+		buf := make([]byte, 8)
+		order.PutUint64(buf, v)
+		if order == binary.LittleEndian {
+			b = append(b, buf[:n]...)
+		} else {
+			b = append(b, buf[8-n:]...)
+		}
+	}
+	u16 := func(v uint16) { put(2, uint64(v)) }
+	u32 := func(v uint32) { put(4, uint64(v)) }
+	u64 := func(v uint64) { put(8, v) }
+	if order == binary.LittleEndian {
+		b = append(b, "II"...)
+	} else {
+		b = append(b, "MM"...)
+	}
+	u16(43)
+	u16(8)
+	u16(0)
+	u64(16)
+	// IFD0 at 16
+	u64(3)
+	u16(0x0100)
+	u16(16)
+	u64(1)
+	u64(1 << 33)
+	u16(0x010F)
+	u16(2)
+	u64(6)
+	b = append(b, "Canon\x00\x00\x00"...)
+	u16(0x8769)
+	u16(18)
+	u64(1)
+	u64(24 + 3*20 + 8)
+	u64(0)
+	// EXIF IFD at 92
+	u64(2)
+	u16(0x829A)
+	u16(5)
+	u64(1)
+	u32(1)
+	u32(250)
+	u16(0x9003)
+	u16(2)
+	u64(20)
+	u64(92 + 8 + 2*20 + 8)
+	u64(0)
+	b = append(b, "2024:05:06 07:08:09\x00"...)
+	return b
+}
+
+func TestBigTIFF(t *testing.T) {
+	for _, order := range []binary.ByteOrder{binary.LittleEndian, binary.BigEndian} {
+		b := bigTiff(order)
+		x, err := Decode(bytes.NewReader(b), int64(len(b)), &Options{Strict: true})
+		if err != nil {
+			t.Fatalf("There was an error in the %v file: %s", order, err)
+		}
+		if x.Format != "BigTIFF" {
+			t.Errorf("Expected BigTIFF, got %s", x.Format)
+		}
+		width, ok := x.Tags["Image ImageWidth"]
+		if !ok {
+			t.Fatalf("Missing ImageWidth in the %v file: %v", order, x.Tags)
+		}
+		if v, err := width.Uint(0); err != nil || v != 1<<33 {
+			t.Errorf("Expected %d, got %v (%v)", uint64(1<<33), v, err)
+		}
+		expected := map[string]string{
+			"Image Make":            `"Canon"`,
+			"EXIF ExposureTime":     "1/250",
+			"EXIF DateTimeOriginal": `"2024:05:06 07:08:09"`,
+		}
+		for k, v := range expected {
+			if tag, ok := x.Tags[k]; !ok || tag.Printable != v {
+				t.Errorf("Expected %s %s in the %v file, got %v", k, v, order, tag)
+			}
+		}
+	}
+
+	// counts with the high bit set, or wrapping around once multiplied by the type size
+	for _, c := range []struct {
+		at    int
+		count uint64
+	}{{48, 1<<64 - 1}, {104, 1 << 61}} {
+		b := bigTiff(binary.BigEndian)
+		binary.BigEndian.PutUint64(b[c.at:], c.count)
+		if _, err := Decode(bytes.NewReader(b), int64(len(b)), &Options{Strict: true}); !errors.Is(err, ErrInvalidOffset) {
+			t.Errorf("Expected ErrInvalidOffset for the %d count, got %v", c.count, err)
+		}
+		if _, err := Decode(bytes.NewReader(b), int64(len(b)), &Options{Details: true}); err != nil {
+			t.Errorf("There was an error: %s", err)
+		}
+	}
+}
+
+// checkOffsets checks the positions of the tags of x read from the file b: the IFD entry starts
+// with the tag ID and the value bytes are found at ValueOffset, in the entry when inlined.
+func checkOffsets(t *testing.T, b []byte, x *Exif, entrySize int64) {
+	n := 0
+	for _, ifd := range x.IfdList() {
+		for _, e := range ifd.Entries {
+			tag := e.IfdTag
+			if tag.EntryOffset < 0 || tag.EntryOffset+entrySize > int64(len(b)) {
+				t.Errorf("Invalid entry offset of %s %s: %d", ifd.Name, e.Name, tag.EntryOffset)
+				continue
+			}
+			if id := int(tag.order.Uint16(b[tag.EntryOffset:])); id != tag.ID() {
+				t.Errorf("Expected the 0x%04X tag at %d, got 0x%04X", tag.ID(), tag.EntryOffset, id)
+			}
+			// the value follows the tag ID, the type and the count
+			inside := tag.ValueOffset == tag.EntryOffset+entrySize/2+2
+			if tag.Inline != inside || tag.Inline != (tag.ValueLength <= entrySize/2-2) {
+				t.Errorf("Unexpected inline flag of %s %s: %v", ifd.Name, e.Name, tag)
+			}
+			if tag.raw != nil {
+				end := tag.ValueOffset + tag.ValueLength
+				if int64(len(tag.raw)) != tag.ValueLength || end > int64(len(b)) || !bytes.Equal(b[tag.ValueOffset:end], tag.raw) {
+					t.Errorf("Unexpected value range of %s %s: %d, %d", ifd.Name, e.Name, tag.ValueOffset, tag.ValueLength)
+				}
+			}
+			n++
+		}
+	}
+	if n == 0 {
+		t.Errorf("No tag found")
+	}
+}
+
+func TestTagOffsets(t *testing.T) {
+	f := "./test/test.jpg"
+	b, err := ioutil.ReadFile(f)
+	if err != nil {
+		t.Fatal("Error reading file:", f)
+	}
+	x, err := Decode(bytes.NewReader(b), int64(len(b)), &Options{Details: true})
+	if err != nil {
+		t.Fatalf("There was an error: %s", err)
+	}
+	checkOffsets(t, b, x, 12)
+	for _, k := range []string{"Image Make", "EXIF ExposureTime"} {
+		tag := x.Tags[k]
+		if tag == nil || tag.Inline {
+			t.Errorf("Expected the %s value out of the IFD entry, got %v", k, tag)
+		}
+	}
+	if tag := x.Tags["Image Orientation"]; tag == nil || !tag.Inline || tag.ValueLength != 2 {
+		t.Errorf("Expected the Orientation value in the IFD entry, got %v", tag)
+	}
+	if tag := NewShortTag(0x0112, 1); tag.EntryOffset != -1 || tag.ValueOffset != -1 {
+		t.Errorf("Expected no position for a new tag, got %d, %d", tag.EntryOffset, tag.ValueOffset)
+	}
+
+	b = bigTiff(binary.LittleEndian)
+	if x, err = Decode(bytes.NewReader(b), int64(len(b)), nil); err != nil {
+		t.Fatalf("There was an error: %s", err)
+	}
+	checkOffsets(t, b, x, 20)
+	if tag := x.Tags["EXIF ExposureTime"]; tag == nil || !tag.Inline {
+		t.Errorf("Expected the ExposureTime value in the BigTIFF entry, got %v", tag)
+	}
+}
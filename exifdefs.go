@@ -1,5 +1,10 @@
 package exif4go
 
+import (
+	"strconv"
+	"strings"
+)
+
 // makestring removes non-printing characters from a string. 
 // It does not throw an exception when given an out of range character.
 func makestring(values []string) string {
@@ -46,7 +51,9 @@ type FieldType struct {
 	Name string
 }
 
-// field type descriptions as (length, abbreviation, full name) tuples.
+// field type descriptions as (length, abbreviation, full name) tuples, indexed by type.
+// It only covers the types up to IFD (13): use FieldTypeOf to look up any type, including
+// the BigTIFF types 16 to 18 and the Exif 3.0 UTF-8 type 129.
 var FIELD_TYPES = []*FieldType{
 	&FieldType{0, "X", "Proprietary"}, // no such type
 	&FieldType{1, "B", "Byte"},
@@ -59,6 +66,35 @@ var FIELD_TYPES = []*FieldType{
 	&FieldType{2, "SS", "Signed Short"},
 	&FieldType{4, "SL", "Signed Long"},
 	&FieldType{8, "SR", "Signed Ratio"},
+	&FieldType{4, "F", "Float"},
+	&FieldType{8, "D", "Double"},
+	&FieldType{4, "IFD", "IFD"},
+}
+
+// field types beyond FIELD_TYPES, keyed by type.
+var moreFieldTypes = map[int]*FieldType{
+	16:  &FieldType{8, "L8", "Long8"},         // BigTIFF
+	17:  &FieldType{8, "SL8", "Signed Long8"}, // BigTIFF
+	18:  &FieldType{8, "IFD8", "IFD8"},        // BigTIFF
+	129: &FieldType{1, "UTF8", "UTF-8"},       // Exif 3.0
+}
+
+// FieldTypeOf returns the description of the field type t, nil when the type is unknown.
+func FieldTypeOf(t int) *FieldType {
+	if t >= 0 && t < len(FIELD_TYPES) {
+		return FIELD_TYPES[t]
+	}
+	return moreFieldTypes[t]
+}
+
+// knownFieldType tells whether t is a field type described by FieldTypeOf.
+func knownFieldType(t int) bool {
+	return t != 0 && FieldTypeOf(t) != nil
+}
+
+// isStringType tells whether t is a null-terminated string type, ASCII or UTF-8.
+func isStringType(t int) bool {
+	return t == 2 || t == 129
 }
 
 type exifTag struct {
@@ -77,6 +113,7 @@ TODO:
 
 */
 var exifTags = map[int]*exifTag{
+	0x00FE: &exifTag{"NewSubfileType", nil, nil},
 	0x0100: &exifTag{"ImageWidth", nil, nil},
 
 	0x0101: &exifTag{"ImageLength", nil, nil},
@@ -149,6 +186,7 @@ var exifTags = map[int]*exifTag{
 	0x013B: &exifTag{"Artist", nil, nil},
 	0x013E: &exifTag{"WhitePoint", nil, nil},
 	0x013F: &exifTag{"PrimaryChromaticities", nil, nil},
+	0x014A: &exifTag{"SubIFDs", nil, nil},
 	0x0156: &exifTag{"TransferRange", nil, nil},
 	0x0200: &exifTag{"JPEGProc", nil, nil},
 	0x0201: &exifTag{"JPEGInterchangeFormat", nil, nil},
@@ -187,9 +225,27 @@ var exifTags = map[int]*exifTag{
 	0x8825: &exifTag{"GPSInfo", nil, nil},
 	0x8827: &exifTag{"ISOSpeedRatings", nil, nil},
 	0x8828: &exifTag{"OECF", nil, nil},
+	0x8830: &exifTag{"SensitivityType",
+		map[int]string{
+			0: "Unknown",
+			1: "Standard Output Sensitivity",
+			2: "Recommended Exposure Index",
+			3: "ISO Speed",
+			4: "Standard Output Sensitivity and Recommended Exposure Index",
+			5: "Standard Output Sensitivity and ISO Speed",
+			6: "Recommended Exposure Index and ISO Speed",
+			7: "Standard Output Sensitivity, Recommended Exposure Index and ISO Speed"}, nil},
+	0x8831: &exifTag{"StandardOutputSensitivity", nil, nil},
+	0x8832: &exifTag{"RecommendedExposureIndex", nil, nil},
+	0x8833: &exifTag{"ISOSpeed", nil, nil},
+	0x8834: &exifTag{"ISOSpeedLatitudeyyy", nil, nil},
+	0x8835: &exifTag{"ISOSpeedLatitudezzz", nil, nil},
 	0x9000: &exifTag{"ExifVersion", nil, makestring},
 	0x9003: &exifTag{"DateTimeOriginal", nil, nil},
 	0x9004: &exifTag{"DateTimeDigitized", nil, nil},
+	0x9010: &exifTag{"OffsetTime", nil, nil},
+	0x9011: &exifTag{"OffsetTimeOriginal", nil, nil},
+	0x9012: &exifTag{"OffsetTimeDigitized", nil, nil},
 	0x9101: &exifTag{"ComponentsConfiguration",
 		map[int]string{
 			0: "",
@@ -257,6 +313,14 @@ var exifTags = map[int]*exifTag{
 	0x9291: &exifTag{"SubSecTimeOriginal", nil, nil},
 	0x9292: &exifTag{"SubSecTimeDigitized", nil, nil},
 
+	// Exif 2.31 ambient conditions
+	0x9400: &exifTag{"Temperature", nil, nil},
+	0x9401: &exifTag{"Humidity", nil, nil},
+	0x9402: &exifTag{"Pressure", nil, nil},
+	0x9403: &exifTag{"WaterDepth", nil, nil},
+	0x9404: &exifTag{"Acceleration", nil, nil},
+	0x9405: &exifTag{"CameraElevationAngle", nil, nil},
+
 	// used by Windows Explorer
 	0x9C9B: &exifTag{"XPTitle", nil, nil},
 	0x9C9C: &exifTag{"XPComment", nil, nil},
@@ -318,7 +382,7 @@ var exifTags = map[int]*exifTag{
 			0: "Standard",
 			1: "Landscape",
 			2: "Portrait",
-			3: "Night)"}, nil},
+			3: "Night"}, nil},
 	0xA407: &exifTag{"GainControl",
 		map[int]string{
 			0: "None",
@@ -342,9 +406,43 @@ var exifTags = map[int]*exifTag{
 			1: "Soft",
 			2: "Hard"}, nil},
 	0xA40B: &exifTag{"DeviceSettingDescription", nil, nil},
-	0xA40C: &exifTag{"SubjectDistanceRange", nil, nil},
+	0xA40C: &exifTag{"SubjectDistanceRange",
+		map[int]string{
+			0: "Unknown",
+			1: "Macro",
+			2: "Close View",
+			3: "Distant View"}, nil},
+	0xA420: &exifTag{"ImageUniqueID", nil, nil},
+	0xA430: &exifTag{"CameraOwnerName", nil, nil},
+	0xA431: &exifTag{"BodySerialNumber", nil, nil},
+	0xA432: &exifTag{"LensSpecification", nil, nil},
+	0xA433: &exifTag{"LensMake", nil, nil},
+	0xA434: &exifTag{"LensModel", nil, nil},
+	0xA435: &exifTag{"LensSerialNumber", nil, nil},
+	// Exif 3.0
+	0xA436: &exifTag{"ImageTitle", nil, nil},
+	0xA437: &exifTag{"Photographer", nil, nil},
+	0xA438: &exifTag{"ImageEditor", nil, nil},
+	0xA439: &exifTag{"CameraFirmware", nil, nil},
+	0xA43A: &exifTag{"RAWDevelopingSoftware", nil, nil},
+	0xA43B: &exifTag{"ImageEditingSoftware", nil, nil},
+	0xA43C: &exifTag{"MetadataEditingSoftware", nil, nil},
+	// Exif 2.32
+	0xA460: &exifTag{"CompositeImage",
+		map[int]string{
+			0: "Unknown",
+			1: "Not a Composite Image",
+			2: "General Composite Image",
+			3: "Composite Image Captured While Shooting"}, nil},
+	0xA461: &exifTag{"SourceImageNumberOfCompositeImage", nil, nil},
+	0xA462: &exifTag{"SourceExposureTimesOfCompositeImage", nil, nil},
 	0xA500: &exifTag{"Gamma", nil, nil},
 	0xC4A5: &exifTag{"PrintIM", nil, nil},
+
+	// DNG
+	0xC612: &exifTag{"DNGVersion", nil, nil},
+	0xC613: &exifTag{"DNGBackwardVersion", nil, nil},
+	0xC614: &exifTag{"UniqueCameraModel", nil, nil},
 	0xEA1C: &exifTag{"Padding", nil, nil},
 }
 
@@ -386,7 +484,14 @@ var gpsTags = map[int]*exifTag{
 	0x0018: &exifTag{"GPSDestBearing", nil, nil},
 	0x0019: &exifTag{"GPSDestDistanceRef", nil, nil},
 	0x001A: &exifTag{"GPSDestDistance", nil, nil},
+	0x001B: &exifTag{"GPSProcessingMethod", nil, nil},
+	0x001C: &exifTag{"GPSAreaInformation", nil, nil},
 	0x001D: &exifTag{"GPSDate", nil, nil},
+	0x001E: &exifTag{"GPSDifferential",
+		map[int]string{
+			0: "Measurement Without Differential Correction",
+			1: "Differential Correction Applied"}, nil},
+	0x001F: &exifTag{"GPSHPositioningError", nil, nil},
 }
 
 // Ignore these tags when quick processing.
@@ -396,12 +501,15 @@ var ignoreTags = []int{0x9286, 0x927C}
 
 // Canon tags
 var makerNoteCanonTags = map[int]*exifTag{
+	0x0001: &exifTag{"CameraSettings", nil, nil},
+	0x0004: &exifTag{"ShotInfo", nil, nil},
 	0x0006: &exifTag{"ImageType", nil, nil},
 	0x0007: &exifTag{"FirmwareVersion", nil, nil},
 	0x0008: &exifTag{"ImageNumber", nil, nil},
 	0x0009: &exifTag{"OwnerName", nil, nil},
 }
 
+// Canon CameraSettings (tag 0x0001) array.
 // This is in element offset, name, optional value dictionary format.
 var makerNoteCanonTags_0x001 = map[int]*exifTag{
 	1: &exifTag{"Macromode",
@@ -522,14 +630,15 @@ var makerNoteCanonTags_0x001 = map[int]*exifTag{
 			14: "External E-TTL",
 			13: "Internal Flash",
 			11: "FP Sync Used",
-			7:  "2nd&exifTag{\"Rear\")-Curtain Sync Used",
+			7:  "2nd (Rear)-Curtain Sync Used",
 			4:  "FP Sync Enabled"}, nil},
-	32: &exifTag{"FocusMode",
+	32: &exifTag{"FocusContinuous",
 		map[int]string{
 			0: "Single",
 			1: "Continuous"}, nil},
 }
 
+// Canon ShotInfo (tag 0x0004) array.
 var makerNoteCanonTags_0x004 = map[int]*exifTag{
 	7: &exifTag{"WhiteBalance",
 		map[int]string{
@@ -563,3 +672,137 @@ var makerNoteCanonTags_0x004 = map[int]*exifTag{
 			0x0040: "2 EV"}, nil},
 	19: &exifTag{"SubjectDistance", nil, nil},
 }
+
+// nikonISO returns the ISO speed of the Nikon ISO tag, stored as the second of two values.
+func nikonISO(values []string) string {
+	if len(values) < 2 {
+		return strings.Join(values, ", ")
+	}
+	return values[1]
+}
+
+// nikonLensType lists the features flagged in the Nikon LensType tag.
+func nikonLensType(values []string) string {
+	if len(values) == 0 {
+		return ""
+	}
+	v, err := strconv.Atoi(values[0])
+	if err != nil {
+		return values[0]
+	}
+	features := []string{}
+	for i, name := range []string{"MF", "D", "G", "VR", "1", "FT-1", "E", "AF-P"} {
+		if v&(1<<uint(i)) != 0 {
+			features = append(features, name)
+		}
+	}
+	if len(features) == 0 {
+		return "AF"
+	}
+	return strings.Join(features, " ")
+}
+
+// Nikon tags of the type 2 and type 3 MakerNote, used from the E99x and D1 models on.
+var makerNoteNikonTags = map[int]*exifTag{
+	0x0001: &exifTag{"MakernoteVersion", nil, makestring},
+	0x0002: &exifTag{"ISO", nil, nikonISO},
+	0x0003: &exifTag{"ColorMode", nil, nil},
+	0x0004: &exifTag{"Quality", nil, nil},
+	0x0005: &exifTag{"WhiteBalance", nil, nil},
+	0x0006: &exifTag{"ImageSharpening", nil, nil},
+	0x0007: &exifTag{"FocusMode", nil, nil},
+	0x0008: &exifTag{"FlashSetting", nil, nil},
+	0x0009: &exifTag{"AutoFlashMode", nil, nil},
+	0x000B: &exifTag{"WhiteBalanceBias", nil, nil},
+	0x000C: &exifTag{"WhiteBalanceRBCoeff", nil, nil},
+	0x000F: &exifTag{"ISOSelection", nil, nil},
+	0x0012: &exifTag{"FlashCompensation", nil, nil},
+	0x0013: &exifTag{"ISOSpeedRequested", nil, nikonISO},
+	0x0016: &exifTag{"PhotoCornerCoordinates", nil, nil},
+	0x0018: &exifTag{"FlashBracketCompensationApplied", nil, nil},
+	0x0019: &exifTag{"AEBracketCompensationApplied", nil, nil},
+	0x001A: &exifTag{"ImageProcessing", nil, nil},
+	0x001B: &exifTag{"CropHiSpeed", nil, nil},
+	0x001D: &exifTag{"SerialNumber", nil, nil},
+	0x001E: &exifTag{"ColorSpace",
+		map[int]string{
+			1: "sRGB",
+			2: "Adobe RGB"}, nil},
+	0x0022: &exifTag{"ActiveDLighting", nil, nil},
+	0x0080: &exifTag{"ImageAdjustment", nil, nil},
+	0x0081: &exifTag{"ToneCompensation", nil, nil},
+	0x0082: &exifTag{"AuxiliaryLens", nil, nil},
+	0x0083: &exifTag{"LensType", nil, nikonLensType},
+	0x0084: &exifTag{"Lens", nil, nil},
+	0x0085: &exifTag{"ManualFocusDistance", nil, nil},
+	0x0086: &exifTag{"DigitalZoomFactor", nil, nil},
+	0x0087: &exifTag{"FlashMode",
+		map[int]string{
+			0: "Did Not Fire",
+			1: "Fired, Manual",
+			7: "Fired, External",
+			8: "Fired, Commander Mode",
+			9: "Fired, TTL Mode"}, nil},
+	0x0089: &exifTag{"ShootingMode", nil, nil},
+	0x008B: &exifTag{"LensFStops", nil, nil},
+	0x008D: &exifTag{"ColorHue", nil, nil},
+	0x008F: &exifTag{"SceneMode", nil, nil},
+	0x0090: &exifTag{"LightSource", nil, nil},
+	0x0092: &exifTag{"HueAdjustment", nil, nil},
+	0x0095: &exifTag{"NoiseReduction", nil, nil},
+	0x00A0: &exifTag{"LegacySerialNumber", nil, nil}, // older models, 0x001D on the later ones
+	0x00A2: &exifTag{"ImageDataSize", nil, nil},
+	0x00A5: &exifTag{"ImageCount", nil, nil},
+	0x00A6: &exifTag{"DeletedImageCount", nil, nil},
+	0x00A7: &exifTag{"ShutterCount", nil, nil},
+	0x00A9: &exifTag{"ImageOptimization", nil, nil},
+	0x00AA: &exifTag{"Saturation", nil, nil},
+	0x00AB: &exifTag{"VariProgram", nil, nil},
+	0x00B1: &exifTag{"HighISONoiseReduction", nil, nil},
+	0x0E09: &exifTag{"NikonCaptureVersion", nil, nil},
+	0x0E22: &exifTag{"NEFBitDepth", nil, nil},
+}
+
+// Nikon tags of the type 1 MakerNote, used by the early Coolpix models.
+var makerNoteNikonOldTags = map[int]*exifTag{
+	0x0003: &exifTag{"Quality",
+		map[int]string{
+			1: "VGA Basic",
+			2: "VGA Normal",
+			3: "VGA Fine",
+			4: "SXGA Basic",
+			5: "SXGA Normal",
+			6: "SXGA Fine"}, nil},
+	0x0004: &exifTag{"ColorMode",
+		map[int]string{
+			1: "Color",
+			2: "Monochrome"}, nil},
+	0x0005: &exifTag{"ImageAdjustment",
+		map[int]string{
+			0: "Normal",
+			1: "Bright+",
+			2: "Bright-",
+			3: "Contrast+",
+			4: "Contrast-"}, nil},
+	0x0006: &exifTag{"CCDSpeed",
+		map[int]string{
+			0: "ISO 80",
+			2: "ISO 160",
+			4: "ISO 320",
+			5: "ISO 100"}, nil},
+	0x0007: &exifTag{"WhiteBalance",
+		map[int]string{
+			0: "Auto",
+			1: "Preset",
+			2: "Daylight",
+			3: "Incandescent",
+			4: "Fluorescent",
+			5: "Cloudy",
+			6: "Speed Light"}, nil},
+	0x0008: &exifTag{"Focus", nil, nil},
+	0x000A: &exifTag{"DigitalZoom", nil, nil},
+	0x000B: &exifTag{"Converter",
+		map[int]string{
+			0: "None",
+			1: "Fisheye"}, nil},
+}
@@ -1,9 +1,12 @@
 package exif4go
 
 import (
+	"encoding/binary"
 	"errors"
 	"fmt"
-	"os"
+	"io"
+	"math"
+	"math/big"
 	"strconv"
 	"strings"
 )
@@ -53,7 +56,7 @@ type IfdTag struct {
 	Printable string
 	// tag ID number
 	tag int
-	//field type as index into FIELD_TYPES
+	// field type, described by FieldTypeOf
 	Fieldtype int
 	// offset of start of field in bytes from beginning of IFD
 	fieldoffset int
@@ -61,33 +64,245 @@ type IfdTag struct {
 	fieldlength int
 	// either a string or array of data items
 	Values []string
+	// number of data items
+	count int
+	// undecoded data items as stored in the file
+	raw []byte
+	// byte order of raw
+	order binary.ByteOrder
+	// absolute position in the file of the IFD entry of the tag, 12 bytes long, 20 bytes in
+	// BigTIFF and 10 bytes in the CRW records, -1 for the tags not read from an entry
+	EntryOffset int64
+	// absolute position in the file of the value of the tag, -1 when not read from a file.
+	// For the EXIF information decoded in memory, from the text chunks of PNG files or the HEIF
+	// items made of several extents, EntryOffset and ValueOffset are positions in that data.
+	ValueOffset int64
+	// length in bytes of the value of the tag
+	ValueLength int64
+	// whether the value is stored in the IFD entry itself
+	Inline bool
 }
 
 func (t *IfdTag) String() string {
+	name := "Unknown"
+	if ft := FieldTypeOf(t.Fieldtype); ft != nil {
+		name = ft.Name
+	}
 	return fmt.Sprintf("(0x%04X) %s=%s @ %d", t.tag,
-		FIELD_TYPES[t.Fieldtype].Name,
+		name,
 		t.Printable,
 		t.fieldoffset)
 }
 
+// ID returns the tag ID number. For the tags expanded from the items of a Canon MakerNote
+// array, such as "MakerNote FocusMode", it is the position of the item in the array.
+func (t *IfdTag) ID() int {
+	return t.tag
+}
+
+// Count returns the number of data items in the tag.
+func (t *IfdTag) Count() int {
+	return t.count
+}
+
+// item returns the raw bytes of the i-th data item.
+func (t *IfdTag) item(i int) ([]byte, error) {
+	ft := FieldTypeOf(t.Fieldtype)
+	if ft == nil {
+		return nil, ErrTagType
+	}
+	size := int(ft.Size)
+	if i < 0 || i >= t.count || (i+1)*size > len(t.raw) {
+		return nil, ErrValueIndex
+	}
+	return t.raw[i*size : (i+1)*size], nil
+}
+
+// Int returns the i-th item of a Byte, Short, Long, Long8, Undefined, IFD or signed integer tag.
+func (t *IfdTag) Int(i int) (int64, error) {
+	switch t.Fieldtype {
+	case 1, 3, 4, 6, 7, 8, 9, 13, 16, 17, 18:
+		item, err := t.item(i)
+		if err != nil {
+			return 0, err
+		}
+		return decodeInt(item, t.order, IntSlice{6, 8, 9, 17}.contains(t.Fieldtype)), nil
+	}
+	return 0, ErrTagType
+}
+
+// Uint returns the i-th item of a Byte, Short, Long, Long8, Undefined or IFD tag.
+func (t *IfdTag) Uint(i int) (uint64, error) {
+	switch t.Fieldtype {
+	case 1, 3, 4, 7, 13, 16, 18:
+		item, err := t.item(i)
+		if err != nil {
+			return 0, err
+		}
+		return uint64(decodeInt(item, t.order, false)), nil
+	}
+	return 0, ErrTagType
+}
+
+// Rat2 returns the numerator and denominator of the i-th item of a Ratio or Signed Ratio tag.
+func (t *IfdTag) Rat2(i int) (num int64, den int64, err error) {
+	if t.Fieldtype != 5 && t.Fieldtype != 10 {
+		return 0, 0, ErrTagType
+	}
+	item, err := t.item(i)
+	if err != nil {
+		return 0, 0, err
+	}
+	signed := t.Fieldtype == 10
+	return decodeInt(item[0:4], t.order, signed), decodeInt(item[4:8], t.order, signed), nil
+}
+
+// Rat returns the i-th item of a Ratio or Signed Ratio tag as a big.Rat.
+// A zero denominator is reported as an error.
+func (t *IfdTag) Rat(i int) (*big.Rat, error) {
+	num, den, err := t.Rat2(i)
+	if err != nil {
+		return nil, err
+	}
+	if den == 0 {
+		return nil, fmt.Errorf("zero denominator in tag 0x%04X", t.tag)
+	}
+	return big.NewRat(num, den), nil
+}
+
+// Float returns the i-th item of any numeric tag as a float64.
+func (t *IfdTag) Float(i int) (float64, error) {
+	switch t.Fieldtype {
+	case 5, 10:
+		num, den, err := t.Rat2(i)
+		if err != nil {
+			return 0, err
+		}
+		if den == 0 {
+			return 0, fmt.Errorf("zero denominator in tag 0x%04X", t.tag)
+		}
+		return float64(num) / float64(den), nil
+	case 11, 12:
+		item, err := t.item(i)
+		if err != nil {
+			return 0, err
+		}
+		return decodeFloat(item, t.order), nil
+	}
+	v, err := t.Int(i)
+	return float64(v), err
+}
+
+// StringVal returns the value of an ASCII or UTF-8 tag without the terminating null.
+func (t *IfdTag) StringVal() (string, error) {
+	if !isStringType(t.Fieldtype) {
+		return "", ErrTagType
+	}
+	return strings.SplitN(string(t.raw), "\x00", 2)[0], nil
+}
+
+// Bytes returns a copy of the undecoded value data as stored in the file.
+func (t *IfdTag) Bytes() []byte {
+	return append([]byte(nil), t.raw...)
+}
+
+// decodeInt converts a 1, 2, 4 or 8 bytes integer in the given byte order.
+func decodeInt(b []byte, order binary.ByteOrder, signed bool) int64 {
+	var u uint64
+	switch len(b) {
+	case 1:
+		u = uint64(b[0])
+	case 2:
+		u = uint64(order.Uint16(b))
+	case 4:
+		u = uint64(order.Uint32(b))
+	case 8:
+		u = order.Uint64(b)
+	}
+	// Sign extension ?
+	if signed {
+		shift := uint(64 - 8*len(b))
+		return int64(u<<shift) >> shift
+	}
+	return int64(u)
+}
+
+// decodeFloat converts a 4 or 8 bytes IEEE-754 floating point number in the given byte order.
+func decodeFloat(b []byte, order binary.ByteOrder) float64 {
+	if len(b) == 4 {
+		return float64(math.Float32frombits(order.Uint32(b)))
+	}
+	return math.Float64frombits(order.Uint64(b))
+}
+
+// decodeValues converts count items of the given field type stored in raw into their decimal strings.
+func decodeValues(fieldtype int, count int, raw []byte, order binary.ByteOrder) []string {
+	ft := FieldTypeOf(fieldtype)
+	if ft == nil {
+		return nil
+	}
+	typelen := int(ft.Size)
+	signed := IntSlice{6, 8, 9, 10, 17}.contains(fieldtype)
+	values := make([]string, 0, count)
+	for i := 0; i < count; i++ {
+		item := raw[i*typelen : (i+1)*typelen]
+		switch fieldtype {
+		case 5, 10:
+			// a ratio
+			num := decodeInt(item[0:4], order, signed)
+			den := decodeInt(item[4:8], order, signed)
+			values = append(values, newRatio(int(num), int(den)).String())
+		case 11:
+			values = append(values, strconv.FormatFloat(decodeFloat(item, order), 'g', -1, 32))
+		case 12:
+			values = append(values, strconv.FormatFloat(decodeFloat(item, order), 'g', -1, 64))
+		default:
+			values = append(values, strconv.FormatInt(decodeInt(item, order, signed), 10))
+		}
+	}
+	return values
+}
+
+// makePrintable joins the values of a tag, long lists are cut after 20 values.
+func makePrintable(fieldtype int, count int, values []string) string {
+	var printable string
+	// now 'values' is either a string or an array, empty when the values were not decoded
+	if count == 1 && len(values) == 1 && !isStringType(fieldtype) {
+		printable = values[0]
+	} else if count > 50 && len(values) > 20 {
+		printable = "[" + strings.Join(values[0:20], ", ") + ", ... ]"
+	} else {
+		printable = strings.Join(values, ", ")
+		if isStringType(fieldtype) {
+			printable = strconv.Quote(printable)
+		}
+	}
+	return printable
+}
+
 type exifHeader struct {
-	file     *os.File
-	endian   []byte
-	offset   int64
-	fakeExif bool
-	strict   bool
-	debug    bool
-	tags     map[string]*IfdTag
+	reader io.ReaderAt
+	endian []byte
+	offset int64
+	size   int64
+	opts   *Options
+	tags   map[string]*IfdTag
+	// BigTIFF layout: 8 bytes offsets and counts, 20 bytes IFD entries
+	bigTiff bool
+	// tags of each IFD in file order, by IFD name
+	entries map[string][]IfdEntry
+	// tags of the IFDs with an IfdID, by TagKey
+	keyed map[TagKey]*IfdTag
 }
 
-func newExifHeader(file *os.File,
+func newExifHeader(reader io.ReaderAt,
+	size int64,
 	endian []byte,
 	offset int64,
-	fakeExif bool,
-	strict bool,
-	debug bool) *exifHeader {
+	opts *Options) *exifHeader {
 	tags := make(map[string]*IfdTag)
-	hdr := &exifHeader{file, endian, offset, fakeExif, strict, debug, tags}
+	hdr := &exifHeader{reader, endian, offset, size, opts, tags, false,
+		make(map[string][]IfdEntry), make(map[TagKey]*IfdTag)}
 	return hdr
 }
 
@@ -122,12 +337,9 @@ func (eh *exifHeader) s2n_intel(str []byte) (val int) {
 */
 func (eh *exifHeader) s2n(offset int, length uint, signed bool) (val int, err error) {
 
-	eh.file.Seek(eh.offset+int64(offset), 0)
-
-	s := make([]byte, length)
-
-	if _, err1 := eh.file.Read(s); err1 != nil {
-		return -1, err1
+	s, err := eh.readBytes(offset, int(length))
+	if err != nil {
+		return -1, err
 	}
 	if eh.endian[0] == 'I' {
 		val = int(eh.s2n_intel(s))
@@ -147,6 +359,58 @@ func (eh *exifHeader) s2n(offset int, length uint, signed bool) (val int, err er
 	return val, err
 }
 
+// byteOrder returns the byte order matching the endian flag.
+func (eh *exifHeader) byteOrder() binary.ByteOrder {
+	if eh.endian[0] == 'I' {
+		return binary.LittleEndian
+	}
+	return binary.BigEndian
+}
+
+// readBytes reads length bytes starting at offset, relative to the beginning of the EXIF information.
+// Out of range reads are reported as a *FormatError before anything is allocated.
+func (eh *exifHeader) readBytes(offset int, length int) ([]byte, error) {
+	pos := eh.offset + int64(offset)
+	if offset < 0 || length < 0 {
+		return nil, &FormatError{Tag: -1, Offset: pos, Err: ErrInvalidOffset}
+	}
+	if pos+int64(length) > eh.size {
+		return nil, newFormatError(nil, pos, int64(length), eh.size)
+	}
+	b := make([]byte, length)
+	if _, err := eh.reader.ReadAt(b, pos); err != nil {
+		return nil, newFormatError(err, pos, int64(length), eh.size)
+	}
+	return b, nil
+}
+
+// subHeader returns a header for a TIFF structure embedded at offset, e.g. in a makernote,
+// whose offsets are relative to its own TIFF header. The tags are stored along with the parent ones.
+func (eh *exifHeader) subHeader(offset int) (*exifHeader, error) {
+	b, err := eh.readBytes(offset, 4)
+	if err != nil {
+		return nil, err
+	}
+	if string(b) != "II*\x00" && string(b) != "MM\x00*" {
+		return nil, &FormatError{Tag: -1, Offset: eh.offset + int64(offset), Err: errors.New("missing TIFF header")}
+	}
+	sub := newExifHeader(eh.reader, eh.size, b[0:1], eh.offset+int64(offset), eh.opts)
+	sub.tags, sub.entries, sub.keyed = eh.tags, eh.entries, eh.keyed
+	return sub, nil
+}
+
+// tagInt returns the first value of a tag holding an offset or a length.
+func (eh *exifHeader) tagInt(t *IfdTag) (int, error) {
+	v, err := t.Int(0)
+	if err == nil && v < 0 {
+		err = ErrInvalidOffset
+	}
+	if err != nil {
+		return 0, &FormatError{Tag: t.tag, Offset: eh.offset + int64(t.fieldoffset), Err: err}
+	}
+	return int(v), nil
+}
+
 // Convert offset to string.
 func (eh *exifHeader) n2s(offset int, length int) string {
 	s := ""
@@ -161,18 +425,39 @@ func (eh *exifHeader) n2s(offset int, length int) string {
 	return s
 }
 
+// ifdLayout returns the size of the entry count, of an entry and of an offset in the IFDs:
+// 2, 12 and 4 bytes in classic TIFF, 8, 20 and 8 bytes in BigTIFF.
+func (eh *exifHeader) ifdLayout() (countSize int, entrySize int, offsetSize int) {
+	if eh.bigTiff {
+		return 8, 20, 8
+	}
+	return 2, 12, 4
+}
+
 // Return first IFD.
 func (eh *exifHeader) firstIfd() (int, error) {
+	if eh.bigTiff {
+		// the offset size, always 8, and a reserved short precede the offset
+		size, err := eh.s2n(4, 2, false)
+		if err != nil {
+			return 0, err
+		}
+		if size != 8 {
+			return 0, &FormatError{Tag: -1, Offset: eh.offset + 4, Err: fmt.Errorf("unsupported BigTIFF offset size %d", size)}
+		}
+		return eh.s2n(8, 8, false)
+	}
 	return eh.s2n(4, 4, false)
 }
 
 // Return a pointer to next IFD.
 func (eh *exifHeader) nextIfd(ifd int) (val int, err error) {
-	entries, err := eh.s2n(ifd, 2, false)
+	countSize, entrySize, offsetSize := eh.ifdLayout()
+	entries, err := eh.s2n(ifd, uint(countSize), false)
 	if err != nil {
 		return val, err
 	}
-	val, err = eh.s2n(ifd+2+12*entries, 4, false)
+	val, err = eh.s2n(ifd+countSize+entrySize*entries, uint(offsetSize), false)
 	return
 }
 
@@ -184,7 +469,8 @@ func (eh *exifHeader) listIfds() (a []int, err error) {
 	}
 	//a = make([]int, 0)
 	a = []int{}
-	for i > 0 {
+	// the IFD count is bounded so that a loop in the chain cannot hang the decoder
+	for i > 0 && len(a) < eh.opts.MaxIfds {
 		a = append(a, i)
 		if i, err = eh.nextIfd(i); err != nil {
 			return nil, err
@@ -197,7 +483,6 @@ func (eh *exifHeader) listIfds() (a []int, err error) {
 func (eh *exifHeader) dumpIfd(ifd int,
 	ifdname string,
 	dict map[int]*exifTag,
-	relative int,
 	stoptag string) (err error) {
 
 	if dict == nil {
@@ -207,15 +492,24 @@ func (eh *exifHeader) dumpIfd(ifd int,
 		stoptag = "UNDEF"
 	}
 
-	entries, err := eh.s2n(ifd, 2, false)
+	// report the IFD, tag and entry offset of any parsing error
+	tag, entry := -1, ifd
+	defer func() {
+		if err != nil {
+			err = inIfd(err, ifdname, tag, eh.offset+int64(entry))
+		}
+	}()
+
+	countSize, entrySize, offsetSize := eh.ifdLayout()
+	entries, err := eh.s2n(ifd, uint(countSize), false)
 	if err != nil {
 		return err
 	}
 
 	for i := 0; i < entries; i++ {
 		// entry is index of start of this IFD in the file
-		entry := ifd + 2 + 12*i
-		tag, err := eh.s2n(entry, 2, false)
+		entry = ifd + countSize + entrySize*i
+		tag, err = eh.s2n(entry, 2, false)
 
 		if err != nil {
 			return err
@@ -235,15 +529,15 @@ func (eh *exifHeader) dumpIfd(ifd int,
 
 		//writeInfo(fmt.Sprintf("entry no %d, tag %d, tagname %s", i, tag, tagname))
 		// ignore certain tags for faster processing
-		if detailed || !IntSlice(ignoreTags).contains(tag) {
+		if eh.opts.Details || !IntSlice(ignoreTags).contains(tag) {
 			fieldtype, err := eh.s2n(entry+2, 2, false)
 			if err != nil {
 				return err
 			}
 
 			// unknown field type
-			if !(0 < fieldtype && fieldtype < len(FIELD_TYPES)) {
-				if !eh.strict {
+			if !knownFieldType(fieldtype) {
+				if !eh.opts.Strict {
 					continue
 				} else {
 					return errors.New(fmt.Sprintf("unknown type %d in tag 0x%04X", fieldtype, tag))
@@ -251,130 +545,72 @@ func (eh *exifHeader) dumpIfd(ifd int,
 			}
 
 			//writeInfo("field type:", fieldtype)
-			typelen := FIELD_TYPES[fieldtype].Size
-			count, err := eh.s2n(entry+4, 4, false)
+			typelen := FieldTypeOf(fieldtype).Size
+			count, err := eh.s2n(entry+4, uint(offsetSize), false)
 
 			if err != nil {
 				return err
 			}
-			// Adjust for tag id/type/count (2+2+4 bytes)
+			// a count beyond the size of the file is malformed, and in BigTIFF it could make
+			// the length of the value negative or wrap around
+			if count < 0 || int64(count) > (eh.size-eh.offset)/int64(typelen) {
+				return &FormatError{Tag: tag, Offset: eh.offset + int64(entry), Err: ErrInvalidOffset}
+			}
+			// Adjust for tag id/type/count (2+2+4 bytes, 2+2+8 in BigTIFF)
 			// Now we point at either the data or the 2nd level offset
-			offset := entry + 8
+			offset := entry + 4 + offsetSize
 
-			// If the value fits in 4 bytes, it is inlined, else we
+			// If the value fits in 4 bytes (8 in BigTIFF), it is inlined, else we
 			// need to jump ahead again.
-			if count*int(typelen) > 4 {
-				// offset is not the value; it's a pointer to the value
-				// if relative we set things up so s2n will seek to the right
-				// place when it adds self.offset.  Note that this 'relative'
-				// is for the Nikon type 3 makernote.  Other cameras may use
-				// other relative offsets, which would have to be computed here
-				// slightly differently.
-				if relative > 0 {
-					tmp_offset, err := eh.s2n(offset, 4, false)
-					if err != nil {
-						return err
-					}
-					offset = tmp_offset + ifd - 8
-					if eh.fakeExif {
-						offset = offset + 18
-					}
-				} else {
-					offset, err = eh.s2n(offset, 4, false)
-					if err != nil {
-						return err
-					}
+			inline := count*int(typelen) <= offsetSize
+			if !inline {
+				// offset is not the value; it's a pointer to the value.
+				// Makernotes using offsets relative to some other starting point,
+				// like the Nikon type 3 one, get their own exifHeader (see subHeader).
+				offset, err = eh.s2n(offset, uint(offsetSize), false)
+				if err != nil {
+					return err
 				}
 			}
 
 			fieldoffset := offset
 			values := []string{}
-			if fieldtype == 2 {
-				// special case: null-terminated ASCII string
-				// XXX investigate
-				// sometimes gets too big to fit in int value
-				if count != 0 && count < (2^31) {
-					eh.file.Seek(eh.offset+int64(offset), 0)
-					vals := make([]byte, count)
-					if _, err := eh.file.Read(vals); err != nil {
+			// raw holds the value bytes as stored in the file
+			var raw []byte
+			if isStringType(fieldtype) {
+				// special case: null-terminated ASCII or UTF-8 string
+				if count != 0 {
+					if raw, err = eh.readBytes(offset, count); err != nil {
 						return err
 					}
 					// Drop any garbage after a null.
 					// IMPORTANT: return at most 2 substrings from Split, but NOT JUST 1
-					cleanedVal := strings.SplitN(string(vals), "\x00", 2)[0]
+					cleanedVal := strings.SplitN(string(raw), "\x00", 2)[0]
 					values = append(values, cleanedVal)
 
 				} else {
 					values = append(values, "")
 				}
 			} else {
-				//values = ""
-				is := IntSlice{6, 8, 9, 10}
-				signed := is.contains(fieldtype)
-
 				// XXX investigate
 				// some entries get too big to handle could be malformed
 				// file or problem with self.s2n
-				if count < 1000 {
-					for dummy := 0; dummy < count; dummy++ {
-						var value string
-						switch fieldtype {
-						case 5, 10:
-							// a ratio
-
-							num, err := eh.s2n(offset, 4, signed)
-							if err != nil {
-								return err
-							}
-							den, err := eh.s2n(offset+4, 4, signed)
-							if err != nil {
-								return err
-							}
-							r := newRatio(num, den)
-							value = r.String()
-						default:
-							v, err := eh.s2n(offset, typelen, signed)
-							if err != nil {
-								return err
-							}
-							value = strconv.Itoa(v)
-						}
-
-						values = append(values, value)
-						offset = offset + int(typelen)
-					}
-					// The test above causes problems with tags that are 
-					// supposed to have long values!  Fix up one important case.
-				} else if tagname == "MakerNote" {
-					for dummy := 0; dummy < count; dummy++ {
-						v, err := eh.s2n(offset, typelen, signed)
-						if err != nil {
-							return err
-						}
-						value := strconv.Itoa(v)
-						values = append(values, value)
-						offset = offset + int(typelen)
+				// The test causes problems with tags that are
+				// supposed to have long values!  Fix up one important case.
+				if count <= eh.opts.MaxValues || tagname == "MakerNote" {
+					if raw, err = eh.readBytes(offset, count*int(typelen)); err != nil {
+						return err
 					}
+					values = decodeValues(fieldtype, count, raw, eh.byteOrder())
 				}
 				//else :
 				//    print "Warning: dropping large tag:", tag, tag_name
 			}
 
-			var printable string
-			// now 'values' is either a string or an array
-			if count == 1 && fieldtype != 2 {
-				printable = values[0]
-			} else if count > 50 && len(values) > 20 {
-				printable = "[" + strings.Join(values[0:20], ", ") + ", ... ]"
-			} else {
-				printable = strings.Join(values, ", ")
-				if fieldtype == 2 { // ASCII
-					printable = strconv.Quote(printable)
-				}
-			}
+			printable := makePrintable(fieldtype, count, values)
 
-			// compute printable version of values
-			if tagentry != nil {
+			// compute printable version of values, when they were decoded
+			if tagentry != nil && len(values) > 0 {
 				//writeInfo("Processing tag entry")
 
 				// optional 2nd tag element is present
@@ -403,21 +639,31 @@ func (eh *exifHeader) dumpIfd(ifd int,
 
 					}
 				}
+			}
 
-				k := ifdname + " " + tagname
-				//writeInfo("Setting tag key:", k,"and offset",fieldoffset)
-				eh.tags[k] = &IfdTag{printable, tag,
-					fieldtype,
-					fieldoffset,
-					count * int(typelen),
-					values}
-				testval, _ := eh.tags[k]
-				writeInfo(fmt.Sprintf(" DEBUG:   %s: %s.", tagname, testval))
+			t := &IfdTag{printable, tag,
+				fieldtype,
+				fieldoffset,
+				count * int(typelen),
+				values,
+				count,
+				raw,
+				eh.byteOrder(),
+				eh.offset + int64(entry),
+				eh.offset + int64(fieldoffset),
+				int64(count) * int64(typelen),
+				inline}
+			eh.opts.writeInfo(fmt.Sprintf(" DEBUG:   %s: %s.", tagname, t))
+
+			// the entries are turned into an Ifd by takeIfd
+			eh.entries[ifdname] = append(eh.entries[ifdname], IfdEntry{tagname, t})
+			if id, ok := ifdID(ifdname); ok {
+				eh.keyed[NewTagKey(id, uint16(tag))] = t
 			}
 		}
 
 		if tagname == stoptag {
-			writeInfo("dumpIfd: breaking out of loop, reached stop tag:", stoptag)
+			eh.opts.writeInfo("dumpIfd: breaking out of loop, reached stop tag:", stoptag)
 			break
 		}
 	}
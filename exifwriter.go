@@ -0,0 +1,349 @@
+package exif4go
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+)
+
+// Tags computed by the encoder, their values in a TagSet are ignored.
+const (
+	exifOffsetTag      = 0x8769
+	gpsInfoTag         = 0x8825
+	interopOffsetTag   = 0xA005
+	jpegThumbOffsetTag = 0x0201
+	jpegThumbLengthTag = 0x0202
+)
+
+// TagSet holds the tags of each IFD of an EXIF block to be written by Encode.
+// The order of the tags does not matter and when a tag ID appears more than once in an IFD
+// the last one wins, so appending a tag replaces its previous value.
+// The offsets linking the IFDs (ExifOffset, GPSInfo, InteroperabilityOffset) and the
+// location of the JPEG thumbnail are computed by the encoder.
+type TagSet struct {
+	// IFD0, the main image
+	Image []*IfdTag
+	// EXIF SubIFD
+	Exif []*IfdTag
+	// GPS SubIFD
+	GPS []*IfdTag
+	// Interoperability SubSubIFD, contained in the EXIF SubIFD
+	Interop []*IfdTag
+	// IFD1, the thumbnail image
+	Thumbnail []*IfdTag
+	// JPEG thumbnail data referenced by IFD1, nil for none
+	JPEGThumbnail []byte
+	// names of the tags left out by NewTagSet, sorted
+	Skipped []string
+}
+
+// offsetTags hold offsets to data outside of the IFDs, which a new layout would invalidate.
+var offsetTags = IntSlice{
+	0x0111, // StripOffsets
+	0x0117, // StripByteCounts
+	0x0144, // TileOffsets
+	0x0145, // TileByteCounts
+	0x014A, // SubIFDs
+	0x927C, // MakerNote, whose entries may point anywhere in the file
+}
+
+// NewTagSet groups the tags returned by Decode or ProcessFile by IFD, e.g. to write them back
+// after changing a few of them. The tags of the Image, EXIF, Interoperability, GPS and Thumbnail
+// IFDs are copied except:
+//   - the tags whose values were not kept by the decoder, having more than MaxValues data
+//     items, such as XMP packets or ICC profiles;
+//   - the tags locating data outside of the IFDs: the image strips and tiles, the SubIFDs and
+//     the MakerNote.
+//
+// These tags are listed in Skipped. The MakerNote tags and the tags of other IFDs are left out
+// without being listed, as are the offsets computed by Encode.
+func NewTagSet(tags map[string]*IfdTag) *TagSet {
+	ts := &TagSet{}
+	for k, t := range tags {
+		if strings.HasPrefix(k, "MakerNote ") {
+			continue
+		}
+		if offsetTags.contains(t.tag) || (t.raw == nil && t.count > 0) {
+			ts.Skipped = append(ts.Skipped, k)
+			continue
+		}
+		// the tag names have no spaces, unlike the IFD names such as "Thumbnail EXIF"
+		switch k[:strings.LastIndex(k, " ")+1] {
+		case "Image ":
+			ts.Image = append(ts.Image, t)
+		case "EXIF Interoperability ":
+			ts.Interop = append(ts.Interop, t)
+		case "EXIF ":
+			ts.Exif = append(ts.Exif, t)
+		case "GPS ":
+			ts.GPS = append(ts.GPS, t)
+		case "Thumbnail ":
+			ts.Thumbnail = append(ts.Thumbnail, t)
+		}
+	}
+	sort.Strings(ts.Skipped)
+	return ts
+}
+
+// newTag returns a tag holding count items of the given field type encoded in raw.
+func newTag(id int, fieldtype int, count int, raw []byte, order binary.ByteOrder) *IfdTag {
+	var values []string
+	if isStringType(fieldtype) {
+		values = []string{strings.SplitN(string(raw), "\x00", 2)[0]}
+	} else {
+		values = decodeValues(fieldtype, count, raw, order)
+	}
+	return &IfdTag{makePrintable(fieldtype, count, values), id, fieldtype, 0, len(raw), values, count, raw, order,
+		-1, -1, int64(len(raw)), false}
+}
+
+// NewASCIITag returns an ASCII tag, the terminating null is added.
+func NewASCIITag(id int, s string) *IfdTag {
+	raw := []byte(s + "\x00")
+	return newTag(id, 2, len(raw), raw, binary.BigEndian)
+}
+
+// NewByteTag returns a Byte tag.
+func NewByteTag(id int, v ...byte) *IfdTag {
+	return newTag(id, 1, len(v), append([]byte(nil), v...), binary.BigEndian)
+}
+
+// NewUndefinedTag returns an Undefined tag holding b.
+func NewUndefinedTag(id int, b []byte) *IfdTag {
+	return newTag(id, 7, len(b), append([]byte(nil), b...), binary.BigEndian)
+}
+
+// NewShortTag returns a Short tag.
+func NewShortTag(id int, v ...uint16) *IfdTag {
+	raw := make([]byte, 2*len(v))
+	for i, x := range v {
+		binary.BigEndian.PutUint16(raw[2*i:], x)
+	}
+	return newTag(id, 3, len(v), raw, binary.BigEndian)
+}
+
+// NewLongTag returns a Long tag.
+func NewLongTag(id int, v ...uint32) *IfdTag {
+	raw := make([]byte, 4*len(v))
+	for i, x := range v {
+		binary.BigEndian.PutUint32(raw[4*i:], x)
+	}
+	return newTag(id, 4, len(v), raw, binary.BigEndian)
+}
+
+// NewRatioTag returns a Ratio tag, v holds numerator and denominator pairs.
+func NewRatioTag(id int, v ...uint32) *IfdTag {
+	raw := make([]byte, 4*len(v))
+	for i, x := range v {
+		binary.BigEndian.PutUint32(raw[4*i:], x)
+	}
+	return newTag(id, 5, len(v)/2, raw[:8*(len(v)/2)], binary.BigEndian)
+}
+
+// NewSignedRatioTag returns a Signed Ratio tag, v holds numerator and denominator pairs.
+func NewSignedRatioTag(id int, v ...int32) *IfdTag {
+	raw := make([]byte, 4*len(v))
+	for i, x := range v {
+		binary.BigEndian.PutUint32(raw[4*i:], uint32(x))
+	}
+	return newTag(id, 10, len(v)/2, raw[:8*(len(v)/2)], binary.BigEndian)
+}
+
+// NewFloatTag returns a Float tag.
+func NewFloatTag(id int, v ...float32) *IfdTag {
+	raw := make([]byte, 4*len(v))
+	for i, x := range v {
+		binary.BigEndian.PutUint32(raw[4*i:], math.Float32bits(x))
+	}
+	return newTag(id, 11, len(v), raw, binary.BigEndian)
+}
+
+// NewDoubleTag returns a Double tag.
+func NewDoubleTag(id int, v ...float64) *IfdTag {
+	raw := make([]byte, 8*len(v))
+	for i, x := range v {
+		binary.BigEndian.PutUint64(raw[8*i:], math.Float64bits(x))
+	}
+	return newTag(id, 12, len(v), raw, binary.BigEndian)
+}
+
+// rawIn returns the value data of the tag in the given byte order.
+func (t *IfdTag) rawIn(order binary.ByteOrder) []byte {
+	ft := FieldTypeOf(t.Fieldtype)
+	if ft == nil {
+		return t.raw
+	}
+	size := int(ft.Size)
+	if t.Fieldtype == 5 || t.Fieldtype == 10 {
+		// a ratio is made of two longs
+		size = 4
+	}
+	if size == 1 || t.order == order {
+		return t.raw
+	}
+	out := make([]byte, len(t.raw))
+	for i := 0; i+size <= len(t.raw); i += size {
+		for j := 0; j < size; j++ {
+			out[i+j] = t.raw[i+size-1-j]
+		}
+	}
+	return out
+}
+
+// prepareIfd returns the tags to write in an IFD sorted by ID, without duplicates and computed tags.
+func prepareIfd(tags []*IfdTag) ([]*IfdTag, error) {
+	byID := make(map[int]*IfdTag)
+	for _, t := range tags {
+		switch t.tag {
+		case exifOffsetTag, gpsInfoTag, interopOffsetTag, jpegThumbOffsetTag, jpegThumbLengthTag:
+			continue
+		}
+		if !knownFieldType(t.Fieldtype) || t.Fieldtype == 16 || t.Fieldtype == 17 || t.Fieldtype == 18 {
+			// the Long8, Signed Long8 and IFD8 types only exist in BigTIFF
+			return nil, fmt.Errorf("unknown type %d in tag 0x%04X", t.Fieldtype, t.tag)
+		}
+		if len(t.raw) != t.count*int(FieldTypeOf(t.Fieldtype).Size) {
+			return nil, fmt.Errorf("missing value data in tag 0x%04X", t.tag)
+		}
+		byID[t.tag] = t
+	}
+	out := make([]*IfdTag, 0, len(byID))
+	for _, t := range byID {
+		out = append(out, t)
+	}
+	sortTags(out)
+	return out, nil
+}
+
+// sortTags sorts tags by ID, as required in an IFD.
+func sortTags(tags []*IfdTag) {
+	sort.Slice(tags, func(i, j int) bool { return tags[i].tag < tags[j].tag })
+}
+
+// ifdSize returns the size of an IFD holding tags, including the values that do not fit in the entries.
+func ifdSize(tags []*IfdTag) int {
+	n := 2 + 12*len(tags) + 4
+	for _, t := range tags {
+		if l := len(t.raw); l > 4 {
+			// values start on a word boundary
+			n += l + l%2
+		}
+	}
+	return n
+}
+
+// writeIfd writes the IFD holding tags at position pos of buf, followed by the values that do not fit in the entries.
+func writeIfd(buf []byte, pos int, tags []*IfdTag, next int, order binary.ByteOrder) {
+	order.PutUint16(buf[pos:], uint16(len(tags)))
+	data := pos + 2 + 12*len(tags) + 4
+	for i, t := range tags {
+		entry := pos + 2 + 12*i
+		raw := t.rawIn(order)
+		order.PutUint16(buf[entry:], uint16(t.tag))
+		order.PutUint16(buf[entry+2:], uint16(t.Fieldtype))
+		order.PutUint32(buf[entry+4:], uint32(t.count))
+		if len(raw) <= 4 {
+			// the value is inlined, left justified
+			copy(buf[entry+8:entry+12], raw)
+		} else {
+			order.PutUint32(buf[entry+8:], uint32(data))
+			copy(buf[data:], raw)
+			data += len(raw) + len(raw)%2
+		}
+	}
+	order.PutUint32(buf[pos+2+12*len(tags):], uint32(next))
+}
+
+// setLong sets the value of a one item Long tag created by the encoder.
+func setLong(t *IfdTag, v int) {
+	binary.BigEndian.PutUint32(t.raw, uint32(v))
+}
+
+// Encode serializes a tag set into a TIFF structured EXIF block in the given byte order,
+// binary.LittleEndian ("II") or binary.BigEndian ("MM").
+// The IFDs are laid out one after the other following the TIFF header: IFD0, EXIF, Interoperability,
+// GPS, IFD1 and the JPEG thumbnail. Empty sub IFDs are left out.
+func Encode(ts *TagSet, order binary.ByteOrder) ([]byte, error) {
+	var ifds [5][]*IfdTag
+	for i, tags := range [][]*IfdTag{ts.Image, ts.Exif, ts.Interop, ts.GPS, ts.Thumbnail} {
+		var err error
+		if ifds[i], err = prepareIfd(tags); err != nil {
+			return nil, err
+		}
+	}
+	image, exif, interop, gps, thumb := 0, 1, 2, 3, 4
+
+	// pointers to the sub IFDs and to the thumbnail, set once the layout is known
+	pointers := make(map[int]*IfdTag)
+	addPointer := func(ifd int, id int) {
+		t := NewLongTag(id, 0)
+		pointers[id] = t
+		ifds[ifd] = append(ifds[ifd], t)
+		sortTags(ifds[ifd])
+	}
+	if len(ifds[interop]) > 0 {
+		addPointer(exif, interopOffsetTag)
+	}
+	if len(ifds[exif]) > 0 {
+		addPointer(image, exifOffsetTag)
+	}
+	if len(ifds[gps]) > 0 {
+		addPointer(image, gpsInfoTag)
+	}
+	if ts.JPEGThumbnail != nil {
+		addPointer(thumb, jpegThumbOffsetTag)
+		addPointer(thumb, jpegThumbLengthTag)
+		setLong(pointers[jpegThumbLengthTag], len(ts.JPEGThumbnail))
+	}
+
+	// lay out the IFDs after the 8 bytes header
+	var at [5]int
+	pos := 8
+	for i, tags := range ifds {
+		if len(tags) > 0 || i == image {
+			at[i] = pos
+			pos += ifdSize(tags)
+		}
+	}
+	thumbdata := pos
+	pos += len(ts.JPEGThumbnail)
+	if int64(pos) > 0xFFFFFFFF {
+		return nil, fmt.Errorf("EXIF data too large: %d bytes", pos)
+	}
+
+	if t, ok := pointers[interopOffsetTag]; ok {
+		setLong(t, at[interop])
+	}
+	if t, ok := pointers[exifOffsetTag]; ok {
+		setLong(t, at[exif])
+	}
+	if t, ok := pointers[gpsInfoTag]; ok {
+		setLong(t, at[gps])
+	}
+	if t, ok := pointers[jpegThumbOffsetTag]; ok {
+		setLong(t, thumbdata)
+	}
+
+	buf := make([]byte, pos)
+	if order.Uint16([]byte{1, 0}) == 1 {
+		copy(buf, "II*\x00")
+	} else {
+		copy(buf, "MM\x00*")
+	}
+	order.PutUint32(buf[4:], 8)
+	for i, tags := range ifds {
+		if at[i] == 0 {
+			continue
+		}
+		next := 0
+		if i == image {
+			// IFD1 is linked from IFD0
+			next = at[thumb]
+		}
+		writeIfd(buf, at[i], tags, next, order)
+	}
+	copy(buf[thumbdata:], ts.JPEGThumbnail)
+	return buf, nil
+}
@@ -0,0 +1,164 @@
+package exif4go
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestEncode(t *testing.T) {
+	thumb := []byte("\xFF\xD8\xFF\xD9")
+	ts := &TagSet{
+		Image: []*IfdTag{
+			NewASCIITag(0x010F, "Canon"),
+			NewASCIITag(0x013B, "Nobody"),
+			NewASCIITag(0x013B, "Somebody"),
+			NewShortTag(0x0112, 6),
+		},
+		Exif: []*IfdTag{
+			NewASCIITag(0x9003, "2012:03:04 10:11:12"),
+			NewRatioTag(0x829A, 1, 250),
+			NewSignedRatioTag(0x9204, -2, 3),
+			NewShortTag(0x8827, 400),
+			NewUndefinedTag(0x9000, []byte("0230")),
+		},
+		Interop: []*IfdTag{
+			NewASCIITag(0x0001, "R98"),
+		},
+		GPS: []*IfdTag{
+			NewASCIITag(0x0001, "N"),
+			NewRatioTag(0x0002, 52, 1, 31, 1, 1234, 100),
+			NewByteTag(0x0000, 2, 2, 0, 0),
+		},
+		Thumbnail: []*IfdTag{
+			NewShortTag(0x0103, 6),
+		},
+		JPEGThumbnail: thumb,
+	}
+
+	expected := map[string]string{
+		"Image Make":                                  `"Canon"`,
+		"Image Artist":                                `"Somebody"`,
+		"Image Orientation":                           "Rotated 90 CW",
+		"EXIF DateTimeOriginal":                       `"2012:03:04 10:11:12"`,
+		"EXIF ExposureTime":                           "1/250",
+		"EXIF ExposureBiasValue":                      "-2/3",
+		"EXIF ISOSpeedRatings":                        "400",
+		"EXIF Interoperability InteroperabilityIndex": `"R98"`,
+		"GPS GPSLatitudeRef":                          `"N"`,
+		"GPS GPSLatitude":                             "52, 31, 617/50",
+		"GPS GPSVersionID":                            "2, 2, 0, 0",
+		"Thumbnail Compression":                       "JPEG (old-style)",
+		"Thumbnail JPEGInterchangeFormatLength":       "4",
+	}
+
+	for _, order := range []binary.ByteOrder{binary.LittleEndian, binary.BigEndian} {
+		b, err := Encode(ts, order)
+		if err != nil {
+			t.Fatalf("There was an error: %s", err)
+		}
+		x, err := Decode(bytes.NewReader(b), int64(len(b)), nil)
+		if err != nil {
+			t.Fatalf("Error decoding the %v block: %s", order, err)
+		}
+		tags := x.Tags
+		for k, v := range expected {
+			if tag, ok := tags[k]; !ok {
+				t.Errorf("The key %s is missing in the %v block", k, order)
+			} else if tag.Printable != v {
+				t.Errorf("The value of %s is %s, expected %s", k, tag.Printable, v)
+			}
+		}
+		off, _ := tags["Thumbnail JPEGInterchangeFormat"].Int(0)
+		if !bytes.Equal(b[off:off+4], thumb) {
+			t.Errorf("The thumbnail is not at the offset %d", off)
+		}
+	}
+}
+
+func TestEncodeRoundTrip(t *testing.T) {
+	fpath := "./test/test.jpg"
+	f, err := os.Open(fpath)
+	if err != nil {
+		t.Fatal("Error opening file:", fpath)
+	}
+	defer f.Close()
+	tags, err := Process(f, false)
+	if err != nil {
+		t.Fatalf("There was an error: %s", err)
+	}
+
+	ts := NewTagSet(tags)
+	ts.Image = append(ts.Image, NewASCIITag(0x8298, "Copyright holder"))
+	b, err := Encode(ts, binary.BigEndian)
+	if err != nil {
+		t.Fatalf("There was an error: %s", err)
+	}
+	x, err := Decode(bytes.NewReader(b), int64(len(b)), &Options{Details: true})
+	if err != nil {
+		t.Fatalf("Error decoding the written block: %s", err)
+	}
+	written := x.Tags
+
+	if tag, ok := written["Image Copyright"]; !ok || tag.Printable != `"Copyright holder"` {
+		t.Errorf("The copyright is missing: %v", tag)
+	}
+	if strings.Join(ts.Skipped, ", ") != "EXIF MakerNote" {
+		t.Errorf("Expected the MakerNote to be skipped, got %v", ts.Skipped)
+	}
+	for k, tag := range tags {
+		if strings.HasPrefix(k, "MakerNote ") || k == "EXIF MakerNote" {
+			// the maker note offsets are not valid once it is moved
+			continue
+		}
+		switch k {
+		case "Image ExifOffset", "EXIF InteroperabilityOffset",
+			"Thumbnail JPEGInterchangeFormat", "Thumbnail JPEGInterchangeFormatLength":
+			// offsets change, the thumbnail data is not written
+			continue
+		}
+		if w, ok := written[k]; !ok {
+			t.Errorf("The key %s is missing", k)
+		} else if w.Printable != tag.Printable {
+			t.Errorf("The value of %s is %s, expected %s", k, w.Printable, tag.Printable)
+		}
+	}
+}
+
+func TestNewTagSetSkipped(t *testing.T) {
+	ts := &TagSet{Image: []*IfdTag{
+		NewASCIITag(0x010F, "Canon"),
+		NewLongTag(0x0111, 8),
+		NewLongTag(0x0117, 100),
+		NewUndefinedTag(0x8773, make([]byte, 2000)),
+	}}
+	b, err := Encode(ts, binary.LittleEndian)
+	if err != nil {
+		t.Fatalf("Error encoding: %s", err)
+	}
+	x, err := Decode(bytes.NewReader(b), int64(len(b)), nil)
+	if err != nil {
+		t.Fatalf("There was an error: %s", err)
+	}
+	ts = NewTagSet(x.Tags)
+	if s := strings.Join(ts.Skipped, ", "); s != "Image InterColorProfile, Image StripByteCounts, Image StripOffsets" {
+		t.Errorf("Unexpected skipped tags %s", s)
+	}
+	if b, err = Encode(ts, binary.LittleEndian); err != nil {
+		t.Fatalf("Error encoding the decoded tags: %s", err)
+	}
+	if x, err = Decode(bytes.NewReader(b), int64(len(b)), nil); err != nil {
+		t.Fatalf("There was an error: %s", err)
+	}
+	if tag, ok := x.Tags["Image Make"]; !ok || tag.Printable != `"Canon"` {
+		t.Errorf("Expected the make, got %v", tag)
+	}
+
+	// BigTIFF types cannot be written
+	ts = &TagSet{Image: []*IfdTag{newTag(0x0100, 16, 1, make([]byte, 8), binary.BigEndian)}}
+	if _, err := Encode(ts, binary.LittleEndian); err == nil {
+		t.Errorf("Expected an error for a Long8 tag")
+	}
+}
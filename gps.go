@@ -0,0 +1,118 @@
+package exif4go
+
+import (
+	"fmt"
+	"math"
+	"time"
+)
+
+// Location is the position recorded in the GPS IFD.
+type Location struct {
+	// decimal degrees, negative in the southern hemisphere
+	Latitude float64
+	// decimal degrees, negative west of the Greenwich meridian
+	Longitude float64
+	// meters, negative below sea level, valid when HasAltitude is set
+	Altitude    float64
+	HasAltitude bool
+	// UTC time of the GPS fix, the zero time when GPSDate or GPSTimeStamp is missing or malformed
+	Time time.Time
+}
+
+// gpsRef returns the first character of a reference tag such as GPSLatitudeRef,
+// stored as ASCII by the standard but as a byte by some writers.
+func gpsRef(t *IfdTag) string {
+	if s, err := t.StringVal(); err == nil {
+		if len(s) > 0 {
+			return s[:1]
+		}
+		return ""
+	}
+	if len(t.raw) > 0 {
+		return string(t.raw[:1])
+	}
+	return ""
+}
+
+// gpsDegrees converts a degrees, minutes and seconds tag to decimal degrees,
+// negative when the reference tag equals neg.
+func gpsDegrees(t *IfdTag, ref *IfdTag, neg string) (float64, error) {
+	var deg float64
+	for i, div := range []float64{1, 60, 3600} {
+		if i > 0 && i >= t.Count() {
+			// some writers only store the degrees, or degrees and decimal minutes
+			break
+		}
+		v, err := t.Float(i)
+		if err != nil {
+			return 0, fmt.Errorf("tag 0x%04X: %w", t.tag, err)
+		}
+		deg += v / div
+	}
+	if ref != nil && gpsRef(ref) == neg {
+		deg = -deg
+	}
+	return deg, nil
+}
+
+// gpsTime combines the GPSDate and GPSTimeStamp tags into a UTC time.
+func gpsTime(date *IfdTag, stamp *IfdTag) (time.Time, error) {
+	s, err := date.StringVal()
+	if err != nil {
+		return time.Time{}, fmt.Errorf("tag 0x%04X: %w", date.tag, err)
+	}
+	d, err := time.Parse("2006:01:02", s)
+	if err != nil {
+		return time.Time{}, err
+	}
+	var hms [3]float64
+	for i := range hms {
+		if hms[i], err = stamp.Float(i); err != nil {
+			return time.Time{}, fmt.Errorf("tag 0x%04X: %w", stamp.tag, err)
+		}
+	}
+	sec, frac := math.Modf(hms[2])
+	return time.Date(d.Year(), d.Month(), d.Day(), int(hms[0]), int(hms[1]), int(sec), int(frac*1e9), time.UTC), nil
+}
+
+// Location returns the GPS coordinates, altitude and time of the image.
+// It returns ErrNoLocation when GPSLatitude or GPSLongitude is missing. A malformed altitude or
+// time does not fail the call, HasAltitude is then false and Time the zero time.
+func (x *Exif) Location() (*Location, error) {
+	lat, ok1 := x.Tags["GPS GPSLatitude"]
+	long, ok2 := x.Tags["GPS GPSLongitude"]
+	if !ok1 || !ok2 {
+		return nil, ErrNoLocation
+	}
+	l := &Location{}
+	var err error
+	if l.Latitude, err = gpsDegrees(lat, x.Tags["GPS GPSLatitudeRef"], "S"); err != nil {
+		return nil, err
+	}
+	if l.Longitude, err = gpsDegrees(long, x.Tags["GPS GPSLongitudeRef"], "W"); err != nil {
+		return nil, err
+	}
+
+	// the altitude and the time are best effort: a malformed one is left out
+	if alt, ok := x.Tags["GPS GPSAltitude"]; ok {
+		if v, err := alt.Float(0); err == nil {
+			l.Altitude = v
+			// reference 1 is below sea level
+			if ref, ok := x.Tags["GPS GPSAltitudeRef"]; ok {
+				if v, err := ref.Int(0); err == nil && v == 1 {
+					l.Altitude = -l.Altitude
+				}
+			}
+			l.HasAltitude = true
+		}
+	}
+
+	date, ok1 := x.Tags["GPS GPSDate"]
+	stamp, ok2 := x.Tags["GPS GPSTimeStamp"]
+	if ok1 && ok2 {
+		if t, err := gpsTime(date, stamp); err == nil {
+			l.Time = t
+		}
+	}
+	return l, nil
+}
@@ -0,0 +1,74 @@
+package exif4go
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io/ioutil"
+	"math"
+	"testing"
+	"time"
+)
+
+func TestLocation(t *testing.T) {
+	ts := &TagSet{
+		Image: []*IfdTag{NewASCIITag(0x010F, "Canon")},
+		GPS: []*IfdTag{
+			NewASCIITag(0x0001, "S"),
+			NewRatioTag(0x0002, 33, 1, 51, 1, 5400, 100),
+			NewASCIITag(0x0003, "W"),
+			NewRatioTag(0x0004, 70, 1, 30, 1, 0, 1),
+			NewByteTag(0x0005, 1),
+			NewRatioTag(0x0006, 125, 10),
+			NewRatioTag(0x0007, 14, 1, 5, 1, 3050, 100),
+			NewASCIITag(0x001D, "2009:10:12"),
+		},
+	}
+	b, err := Encode(ts, binary.BigEndian)
+	if err != nil {
+		t.Fatalf("Error encoding: %s", err)
+	}
+	x, err := Decode(bytes.NewReader(b), int64(len(b)), nil)
+	if err != nil {
+		t.Fatalf("There was an error: %s", err)
+	}
+	l, err := x.Location()
+	if err != nil {
+		t.Fatalf("There was an error: %s", err)
+	}
+	if math.Abs(l.Latitude-(-33.865)) > 1e-9 || math.Abs(l.Longitude-(-70.5)) > 1e-9 {
+		t.Errorf("Expected -33.865, -70.5, got %v, %v", l.Latitude, l.Longitude)
+	}
+	if !l.HasAltitude || l.Altitude != -12.5 {
+		t.Errorf("Expected an altitude of -12.5, got %v", l.Altitude)
+	}
+	if want := time.Date(2009, 10, 12, 14, 5, 30, 500000000, time.UTC); !l.Time.Equal(want) {
+		t.Errorf("Expected %v, got %v", want, l.Time)
+	}
+
+	// a 0/0 altitude and time stamp
+	ts.GPS[5] = NewRatioTag(0x0006, 0, 0)
+	ts.GPS[6] = NewRatioTag(0x0007, 14, 1, 5, 1, 0, 0)
+	if b, err = Encode(ts, binary.BigEndian); err != nil {
+		t.Fatalf("Error encoding: %s", err)
+	}
+	if x, err = Decode(bytes.NewReader(b), int64(len(b)), nil); err != nil {
+		t.Fatalf("There was an error: %s", err)
+	}
+	if l, err = x.Location(); err != nil {
+		t.Fatalf("There was an error: %s", err)
+	}
+	if l.Latitude == 0 || l.HasAltitude || !l.Time.IsZero() {
+		t.Errorf("Expected the coordinates only, got %+v", l)
+	}
+
+	fpath := "./test/test.jpg"
+	if b, err = ioutil.ReadFile(fpath); err != nil {
+		t.Fatal("Error reading file:", fpath)
+	}
+	if x, err = Decode(bytes.NewReader(b), int64(len(b)), nil); err != nil {
+		t.Fatalf("There was an error: %s", err)
+	}
+	if _, err := x.Location(); err != ErrNoLocation {
+		t.Errorf("Expected ErrNoLocation, got %v", err)
+	}
+}
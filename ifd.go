@@ -0,0 +1,201 @@
+package exif4go
+
+import (
+	"errors"
+	"fmt"
+	"io"
+)
+
+// maxIfdDepth bounds the nesting of the IFDs pointed to by other IFDs.
+const maxIfdDepth = 8
+
+// Ifd is an IFD of the TIFF structure with the IFDs it points to.
+type Ifd struct {
+	// name of the IFD, prefixing its tags in Exif.Tags: "Image", "Thumbnail", "IFD 2"... for the
+	// main chain, "EXIF", "GPS", "EXIF Interoperability" and "SubIFD 0", "SubIFD 1"... for the
+	// IFDs they point to. The EXIF, GPS and Interoperability IFDs of the IFDs other than IFD0 are
+	// prefixed with the name of the IFD pointing to them, e.g. "Thumbnail EXIF", "IFD 2 EXIF" or
+	// "SubIFD 0 GPS". The records of a Canon CRW file make up the "CIFF" IFD.
+	Name string
+	// absolute position of the IFD in the file
+	Offset int64
+	// tags in file order
+	Entries []IfdEntry
+	// tags keyed by tag name, built from Entries: when a tag appears more than once the last wins
+	Tags map[string]*IfdTag
+	// IFDs pointed to by the SubIFDs, ExifOffset, GPSInfo and InteroperabilityOffset tags,
+	// in this order, then for the EXIF IFD the "MakerNote" IFD when it is decoded
+	Children []*Ifd
+}
+
+// IfdEntry is a tag of an IFD.
+type IfdEntry struct {
+	// tag name, e.g. "Make", or "Tag 0xA5FF" for the tags missing from the dictionaries of the
+	// package, which are left out of Exif.Tags
+	Name string
+	*IfdTag
+}
+
+// ifdWalker decodes the IFD tree, following the pointers to the IFDs of each IFD.
+type ifdWalker struct {
+	eh *exifHeader
+	// offsets of the IFDs already decoded, so that a loop cannot hang the decoder
+	visited map[int]bool
+	// number of SubIFDs found so far
+	subIfds int
+}
+
+func newIfdWalker(eh *exifHeader) *ifdWalker {
+	return &ifdWalker{eh, make(map[int]bool), 0}
+}
+
+// walk decodes the IFD at offset ifd with the given name and tag dictionary, then the IFDs it
+// points to, naming their EXIF, GPS and Interoperability IFDs with the given prefix.
+// Malformed IFDs are skipped unless the options are strict.
+func (w *ifdWalker) walk(ifd int, name string, prefix string, dict map[int]*exifTag, depth int) (*Ifd, error) {
+	eh := w.eh
+	if w.visited[ifd] || depth > maxIfdDepth || len(w.visited) >= eh.opts.MaxIfds {
+		err := &FormatError{Ifd: name, Tag: -1, Offset: eh.offset + int64(ifd), Err: errors.New("IFD loop, or too many or too deeply nested IFDs")}
+		return nil, eh.opts.tolerate(err)
+	}
+	w.visited[ifd] = true
+	if err := eh.opts.tolerate(eh.dumpIfd(ifd, name, dict, eh.opts.StopTag)); err != nil {
+		return nil, err
+	}
+	node := eh.takeIfd(name, eh.offset+int64(ifd), dict)
+
+	// child adds the IFD pointed to by the i-th value of the tag
+	child := func(t *IfdTag, i int, name string, prefix string, dict map[int]*exifTag) error {
+		v, err := t.Int(i)
+		if err != nil {
+			err = &FormatError{Ifd: node.Name, Tag: t.tag, Offset: eh.offset + int64(t.fieldoffset), Err: err}
+			return eh.opts.tolerate(err)
+		}
+		eh.opts.writeInfo(fmt.Sprintf(" %s at offset %d:", name, v))
+		c, err := w.walk(int(v), name, prefix, dict, depth+1)
+		if err != nil {
+			return err
+		}
+		if c != nil {
+			node.Children = append(node.Children, c)
+		}
+		return nil
+	}
+	// SubIFDs of the RAW formats, holding the raw data and the previews
+	if t, ok := node.Tags["SubIFDs"]; ok {
+		for i := 0; i < t.Count(); i++ {
+			sub := fmt.Sprintf("SubIFD %d", w.subIfds)
+			w.subIfds++
+			if err := child(t, i, sub, sub+" ", exifTags); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if t, ok := node.Tags["ExifOffset"]; ok {
+		if err := child(t, 0, prefix+"EXIF", prefix, exifTags); err != nil {
+			return nil, err
+		}
+	}
+	if t, ok := node.Tags["GPSInfo"]; ok {
+		if err := child(t, 0, prefix+"GPS", prefix, gpsTags); err != nil {
+			return nil, err
+		}
+	}
+	if t, ok := node.Tags["InteroperabilityOffset"]; ok {
+		if err := child(t, 0, prefix+"EXIF Interoperability", prefix, interTags); err != nil {
+			return nil, err
+		}
+	}
+	return node, nil
+}
+
+// takeIfd returns the IFD at the absolute position offset whose entries dumpIfd stored under
+// name, and adds to Exif.Tags the entries whose tag is in dict.
+func (eh *exifHeader) takeIfd(name string, offset int64, dict map[int]*exifTag) *Ifd {
+	node := &Ifd{Name: name, Offset: offset, Entries: eh.entries[name]}
+	// the entries are taken, an IFD of the same name does not append to them
+	delete(eh.entries, name)
+	node.Tags = make(map[string]*IfdTag, len(node.Entries))
+	for _, e := range node.Entries {
+		node.Tags[e.Name] = e.IfdTag
+		// the tags missing from the dictionary are only kept by IFD and by key
+		if _, ok := dict[e.tag]; ok {
+			eh.tags[name+" "+e.Name] = e.IfdTag
+		}
+	}
+	return node
+}
+
+// Page is an image of a TIFF file, e.g. a page of a multi-page fax or scan.
+type Page struct {
+	// the IFD describing the image
+	Ifd    *Ifd
+	Width  int
+	Height int
+	// the Compression tag value: 1 for none, 3 and 4 for the CCITT fax encodings, 5 for LZW,
+	// 6 and 7 for JPEG...
+	Compression int
+}
+
+// Pages returns the full resolution images described by the main IFD chain, in file order,
+// leaving out the IFDs without dimensions, such as the IFD0 of a JPEG file, and the reduced
+// resolution images, such as thumbnails.
+func (x *Exif) Pages() []*Page {
+	var pages []*Page
+	for _, ifd := range x.Ifds {
+		if t, ok := ifd.Tags["NewSubfileType"]; ok {
+			if v, err := t.Int(0); err == nil && v&1 != 0 {
+				continue
+			}
+		}
+		w, ok1 := ifd.Tags["ImageWidth"]
+		h, ok2 := ifd.Tags["ImageLength"]
+		if !ok1 || !ok2 {
+			continue
+		}
+		width, err1 := w.Int(0)
+		height, err2 := h.Int(0)
+		if err1 != nil || err2 != nil {
+			continue
+		}
+		p := &Page{Ifd: ifd, Width: int(width), Height: int(height), Compression: 1}
+		if t, ok := ifd.Tags["Compression"]; ok {
+			if v, err := t.Int(0); err == nil {
+				p.Compression = int(v)
+			}
+		}
+		pages = append(pages, p)
+	}
+	return pages
+}
+
+// IfdList returns the IFDs of the tree in the order they are found: each IFD of the main chain
+// is followed by the IFDs it points to, recursively.
+func (x *Exif) IfdList() []*Ifd {
+	var list []*Ifd
+	var add func(ifds []*Ifd)
+	add = func(ifds []*Ifd) {
+		for _, ifd := range ifds {
+			list = append(list, ifd)
+			add(ifd.Children)
+		}
+	}
+	add(x.Ifds)
+	return list
+}
+
+// Dump writes the tags of the IFDs listed by IfdList to w, in file order, one per line
+// after a line naming the IFD, e.g. `Image Make: "Canon"`.
+func (x *Exif) Dump(w io.Writer) error {
+	for _, ifd := range x.IfdList() {
+		if _, err := fmt.Fprintf(w, "%s IFD at offset %d\n", ifd.Name, ifd.Offset); err != nil {
+			return err
+		}
+		for _, e := range ifd.Entries {
+			if _, err := fmt.Fprintf(w, "%s %s: %s\n", ifd.Name, e.Name, e.Printable); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,180 @@
+package exif4go
+
+import (
+	"bytes"
+	"encoding/binary"
+	"strings"
+	"testing"
+)
+
+// multiPageTiff returns a TIFF file of three pages: a CCITT G4 page pointing to a SubIFD and to
+// its EXIF IFD, a CCITT G3 page with its own EXIF IFD, and a reduced resolution image. The SubIFD
+// has an EXIF IFD too. When loop is set the EXIF IFD of the SubIFD points back to IFD0.
+func multiPageTiff(loop bool) []byte {
+	order := binary.LittleEndian
+	page := func(w uint32, h uint32, compression uint16, extra ...*IfdTag) []*IfdTag {
+		tags := append([]*IfdTag{
+			NewLongTag(0x0100, w),
+			NewLongTag(0x0101, h),
+			NewShortTag(0x0103, compression),
+		}, extra...)
+		sortTags(tags)
+		return tags
+	}
+	// IFDs in file order, pos holds their positions
+	layout := func(pos []int) [][]*IfdTag {
+		subExif := []*IfdTag{NewRatioTag(0x829A, 1, 60)}
+		if loop {
+			subExif = append(subExif, NewLongTag(0x8769, uint32(pos[0])))
+		}
+		return [][]*IfdTag{
+			page(1728, 2200, 4, NewLongTag(0x014A, uint32(pos[3])), NewLongTag(0x8769, uint32(pos[4]))),
+			page(1728, 1100, 3, NewLongTag(0x8769, uint32(pos[5]))),
+			page(216, 275, 1, NewLongTag(0x00FE, 1)),
+			page(864, 1100, 4, NewLongTag(0x8769, uint32(pos[6]))),
+			{NewASCIITag(0x9003, "2020:01:02 03:04:05")},
+			{NewASCIITag(0x9003, "2021:01:02 03:04:05")},
+			subExif,
+		}
+	}
+	pos := make([]int, 7)
+	at := 8
+	for i, tags := range layout(pos) {
+		pos[i] = at
+		at += ifdSize(tags)
+	}
+	b := make([]byte, at)
+	copy(b, "II*\x00")
+	order.PutUint32(b[4:], uint32(pos[0]))
+	next := []int{pos[1], pos[2], 0, 0, 0, 0, 0}
+	for i, tags := range layout(pos) {
+		writeIfd(b, pos[i], tags, next[i], order)
+	}
+	return b
+}
+
+func TestIfdTree(t *testing.T) {
+	b := multiPageTiff(false)
+	x, err := Decode(bytes.NewReader(b), int64(len(b)), &Options{Strict: true})
+	if err != nil {
+		t.Fatalf("There was an error: %s", err)
+	}
+	if len(x.Ifds) != 3 {
+		t.Fatalf("Expected 3 IFDs in the main chain, got %d", len(x.Ifds))
+	}
+	names := func(ifds []*Ifd) []string {
+		var s []string
+		for _, ifd := range ifds {
+			s = append(s, ifd.Name)
+		}
+		return s
+	}
+	expected := [][]string{{"SubIFD 0", "EXIF"}, {"Thumbnail EXIF"}, nil}
+	for i, ifd := range x.Ifds {
+		if got := names(ifd.Children); len(got) != len(expected[i]) || (len(got) > 0 && got[0] != expected[i][0]) {
+			t.Errorf("Expected the %v children in IFD %d, got %v", expected[i], i, got)
+		}
+	}
+	sub := x.Ifds[0].Children[0]
+	if len(sub.Children) != 1 || sub.Children[0].Name != "SubIFD 0 EXIF" {
+		t.Fatalf("Expected the EXIF IFD of the SubIFD, got %v", names(sub.Children))
+	}
+	if tag, ok := sub.Children[0].Tags["ExposureTime"]; !ok || tag.Printable != "1/60" {
+		t.Errorf("Expected a 1/60 exposure time, got %v", tag)
+	}
+	for k, v := range map[string]string{
+		"EXIF DateTimeOriginal":           `"2020:01:02 03:04:05"`,
+		"Thumbnail EXIF DateTimeOriginal": `"2021:01:02 03:04:05"`,
+		"SubIFD 0 ImageWidth":             "864",
+		"SubIFD 0 EXIF ExposureTime":      "1/60",
+		"Thumbnail Compression":           "T4/Group 3 Fax",
+		"IFD 2 NewSubfileType":            "1",
+	} {
+		if tag, ok := x.Tags[k]; !ok || tag.Printable != v {
+			t.Errorf("Expected %s %s, got %v", k, v, tag)
+		}
+	}
+
+	// the tags of the EXIF IFD of IFD1 are not IFD1 tags
+	for _, tag := range NewTagSet(x.Tags).Thumbnail {
+		if tag.ID() == 0x9003 {
+			t.Errorf("Unexpected DateTimeOriginal tag in IFD1")
+		}
+	}
+
+	pages := x.Pages()
+	if len(pages) != 2 {
+		t.Fatalf("Expected 2 pages, got %d", len(pages))
+	}
+	for i, p := range []Page{{x.Ifds[0], 1728, 2200, 4}, {x.Ifds[1], 1728, 1100, 3}} {
+		if *pages[i] != p {
+			t.Errorf("Expected page %d to be %v, got %v", i, p, *pages[i])
+		}
+	}
+}
+
+func TestIfdLoop(t *testing.T) {
+	b := multiPageTiff(true)
+	if _, err := Decode(bytes.NewReader(b), int64(len(b)), &Options{Strict: true}); err == nil {
+		t.Errorf("Expected an error for the IFD loop")
+	}
+	x, err := Decode(bytes.NewReader(b), int64(len(b)), nil)
+	if err != nil {
+		t.Fatalf("There was an error: %s", err)
+	}
+	if tag, ok := x.Tags["SubIFD 0 EXIF ExposureTime"]; !ok || tag.Printable != "1/60" {
+		t.Errorf("Expected a 1/60 exposure time, got %v", tag)
+	}
+}
+
+func TestIfdOrder(t *testing.T) {
+	b := multiPageTiff(false)
+	x, err := Decode(bytes.NewReader(b), int64(len(b)), nil)
+	if err != nil {
+		t.Fatalf("There was an error: %s", err)
+	}
+	var names []string
+	for _, ifd := range x.IfdList() {
+		names = append(names, ifd.Name)
+	}
+	expected := []string{"Image", "SubIFD 0", "SubIFD 0 EXIF", "EXIF", "Thumbnail", "Thumbnail EXIF", "IFD 2"}
+	if strings.Join(names, ", ") != strings.Join(expected, ", ") {
+		t.Errorf("Expected the %v IFDs, got %v", expected, names)
+	}
+
+	// entries out of the ascending order, one of them twice
+	order := binary.BigEndian
+	tags := []*IfdTag{
+		NewASCIITag(0x0110, "EOS"),
+		NewASCIITag(0x010F, "Canon"),
+		NewShortTag(0xC7FF, 1),
+		NewASCIITag(0x0110, "EOS R"),
+	}
+	b = make([]byte, 8+ifdSize(tags))
+	copy(b, "MM\x00*")
+	order.PutUint32(b[4:], 8)
+	writeIfd(b, 8, tags, 0, order)
+	x, err = Decode(bytes.NewReader(b), int64(len(b)), nil)
+	if err != nil {
+		t.Fatalf("There was an error: %s", err)
+	}
+	ifd := x.Ifds[0]
+	names = nil
+	for _, e := range ifd.Entries {
+		names = append(names, e.Name)
+	}
+	if strings.Join(names, ", ") != "Model, Make, Tag 0xC7FF, Model" {
+		t.Errorf("Unexpected entries %v", names)
+	}
+	if ifd.Tags["Model"].Printable != `"EOS R"` {
+		t.Errorf("Expected the last Model tag, got %v", ifd.Tags["Model"])
+	}
+	var buf bytes.Buffer
+	if err := x.Dump(&buf); err != nil {
+		t.Fatalf("There was an error: %s", err)
+	}
+	dump := "Image IFD at offset 8\nImage Model: \"EOS\"\nImage Make: \"Canon\"\nImage Tag 0xC7FF: 1\nImage Model: \"EOS R\"\n"
+	if buf.String() != dump {
+		t.Errorf("Expected the dump\n%s\ngot\n%s", dump, buf.String())
+	}
+}
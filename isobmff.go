@@ -0,0 +1,427 @@
+package exif4go
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+)
+
+// maxBoxData bounds the size of the boxes read in memory, e.g. the HEIF meta box.
+const maxBoxData = 1 << 24
+
+// heifBrands lists the ftyp brands of the HEIF based formats: HEIC, HEIF and AVIF images and sequences.
+var heifBrands = StringSlice{"heic", "heix", "hevc", "hevx", "heim", "heis", "hevm", "hevs", "mif1", "msf1", "mif2", "avif", "avis"}
+
+// bmffBox is an ISO base media file format box.
+type bmffBox struct {
+	typ string
+	// absolute positions of the payload and of the end of the box
+	data int64
+	end  int64
+}
+
+// readBox reads the header of the box starting at offset, end bounds the box and its parent.
+func readBox(r io.ReaderAt, offset int64, end int64) (*bmffBox, error) {
+	hdr := make([]byte, 16)
+	if _, err := r.ReadAt(hdr[:8], offset); err != nil {
+		return nil, newFormatError(err, offset, 8, end)
+	}
+	box := &bmffBox{typ: string(hdr[4:8]), data: offset + 8}
+	size := int64(binary.BigEndian.Uint32(hdr))
+	switch size {
+	case 0:
+		// the box extends to the end of its parent
+		size = end - offset
+	case 1:
+		// 64 bits size following the type
+		if _, err := r.ReadAt(hdr[8:16], offset+8); err != nil {
+			return nil, newFormatError(err, offset+8, 8, end)
+		}
+		size = int64(binary.BigEndian.Uint64(hdr[8:16]))
+		box.data += 8
+	}
+	box.end = offset + size
+	if size < box.data-offset || box.end > end || box.end < offset {
+		return nil, newFormatError(nil, offset, size, end)
+	}
+	return box, nil
+}
+
+// readBoxes returns the boxes found between offset and end.
+func readBoxes(r io.ReaderAt, offset int64, end int64) ([]*bmffBox, error) {
+	var boxes []*bmffBox
+	for offset+8 <= end {
+		box, err := readBox(r, offset, end)
+		if err != nil {
+			return nil, err
+		}
+		boxes = append(boxes, box)
+		offset = box.end
+	}
+	return boxes, nil
+}
+
+// boxData reads the payload of a box, skipping skip bytes, e.g. the version and flags of a full box.
+func boxData(r io.ReaderAt, box *bmffBox, skip int64) ([]byte, error) {
+	n := box.end - box.data - skip
+	if n < 0 || n > maxBoxData {
+		return nil, &FormatError{Tag: -1, Offset: box.data, Err: errors.New("box " + box.typ + " too large or too small")}
+	}
+	b := make([]byte, n)
+	if _, err := r.ReadAt(b, box.data+skip); err != nil {
+		return nil, newFormatError(err, box.data+skip, n, box.end)
+	}
+	return b, nil
+}
+
+// bmffReader reads the big endian fields of a box payload, the first error sticks.
+type bmffReader struct {
+	b   []byte
+	pos int
+	err error
+}
+
+// uint reads an n bytes unsigned integer, n being 0, 1, 2, 4 or 8.
+func (br *bmffReader) uint(n int) uint64 {
+	if br.err != nil {
+		return 0
+	}
+	if br.pos+n > len(br.b) {
+		br.err = ErrTruncated
+		return 0
+	}
+	var v uint64
+	for _, c := range br.b[br.pos : br.pos+n] {
+		v = v<<8 | uint64(c)
+	}
+	br.pos += n
+	return v
+}
+
+// fourcc reads a four characters code.
+func (br *bmffReader) fourcc() string {
+	if br.err != nil || br.pos+4 > len(br.b) {
+		br.err = ErrTruncated
+		return ""
+	}
+	br.pos += 4
+	return string(br.b[br.pos-4 : br.pos])
+}
+
+// heifExtent is a part of the data of an item.
+type heifExtent struct {
+	offset int64
+	length int64
+}
+
+// heifMeta holds the item properties of a HEIF meta box needed to locate the Exif item.
+type heifMeta struct {
+	primary uint64
+	// types of the items, by ID
+	types map[uint64]string
+	// extents of the items, by ID
+	extents map[uint64][]heifExtent
+	// content description references, from item ID to the described items
+	cdsc map[uint64][]uint64
+}
+
+// parseMeta parses the children of the meta box.
+func parseMeta(r io.ReaderAt, meta *bmffBox, size int64) (*heifMeta, error) {
+	m := &heifMeta{types: map[uint64]string{}, extents: map[uint64][]heifExtent{}, cdsc: map[uint64][]uint64{}}
+	// meta is a full box: version and flags precede the children
+	boxes, err := readBoxes(r, meta.data+4, meta.end)
+	if err != nil {
+		return nil, err
+	}
+	var idat, iloc *bmffBox
+	for _, box := range boxes {
+		switch box.typ {
+		case "pitm", "iinf", "iref":
+			b, err := boxData(r, box, 0)
+			if err != nil {
+				return nil, err
+			}
+			br := &bmffReader{b: b}
+			version := br.uint(1)
+			br.uint(3)
+			switch box.typ {
+			case "pitm":
+				m.primary = br.uint(2 + 2*btoi(version > 0))
+			case "iinf":
+				br.uint(2 + 2*btoi(version > 0))
+				// infe boxes follow the entry count
+				infes, err := readBoxes(r, box.data+int64(br.pos), box.end)
+				if err != nil {
+					return nil, err
+				}
+				for _, infe := range infes {
+					if infe.typ != "infe" {
+						continue
+					}
+					b, err := boxData(r, infe, 0)
+					if err != nil {
+						return nil, err
+					}
+					ir := &bmffReader{b: b}
+					v := ir.uint(1)
+					ir.uint(3)
+					if v < 2 {
+						// no item type before version 2
+						continue
+					}
+					id := ir.uint(2 + 2*btoi(v > 2))
+					ir.uint(2)
+					if typ := ir.fourcc(); ir.err == nil {
+						m.types[id] = typ
+					}
+				}
+			case "iref":
+				for br.err == nil && br.pos+8 <= len(br.b) {
+					start := br.pos
+					length := int(br.uint(4))
+					typ := br.fourcc()
+					from := br.uint(2 + 2*btoi(version > 0))
+					n := int(br.uint(2))
+					for i := 0; i < n; i++ {
+						to := br.uint(2 + 2*btoi(version > 0))
+						if typ == "cdsc" {
+							m.cdsc[from] = append(m.cdsc[from], to)
+						}
+					}
+					if length < 8 {
+						break
+					}
+					br.pos = start + length
+				}
+			}
+			if br.err != nil {
+				return nil, &FormatError{Tag: -1, Offset: box.data, Err: br.err}
+			}
+		case "iloc":
+			iloc = box
+		case "idat":
+			idat = box
+		}
+	}
+	if iloc != nil {
+		// the extents may point into idat, which can follow iloc
+		b, err := boxData(r, iloc, 0)
+		if err != nil {
+			return nil, err
+		}
+		if err := m.parseIloc(b, idat, size); err != nil {
+			return nil, &FormatError{Tag: -1, Offset: iloc.data, Err: err}
+		}
+	}
+	return m, nil
+}
+
+// parseIloc reads the item locations, b is the payload of the iloc box.
+func (m *heifMeta) parseIloc(b []byte, idat *bmffBox, size int64) error {
+	br := &bmffReader{b: b}
+	version := br.uint(1)
+	br.uint(3)
+	sizes := br.uint(2)
+	offsetSize, lengthSize := int(sizes>>12), int(sizes>>8&0xF)
+	baseOffsetSize, indexSize := int(sizes>>4&0xF), int(sizes&0xF)
+	if version == 0 {
+		indexSize = 0
+	}
+	count := br.uint(2 + 2*btoi(version == 2))
+	for i := uint64(0); i < count && br.err == nil; i++ {
+		id := br.uint(2 + 2*btoi(version == 2))
+		method := uint64(0)
+		if version > 0 {
+			method = br.uint(2) & 0xF
+		}
+		br.uint(2) // data reference index
+		base := int64(br.uint(baseOffsetSize))
+		extents := int(br.uint(2))
+		for j := 0; j < extents && br.err == nil; j++ {
+			br.uint(indexSize)
+			e := heifExtent{base + int64(br.uint(offsetSize)), int64(br.uint(lengthSize))}
+			switch method {
+			case 0:
+				// file offset
+				if e.length == 0 {
+					e.length = size - e.offset
+				}
+			case 1:
+				// offset in the idat box
+				if idat == nil {
+					continue
+				}
+				if e.length == 0 {
+					e.length = idat.end - idat.data - e.offset
+				}
+				e.offset += idat.data
+			default:
+				// item offsets are not used by Exif items
+				continue
+			}
+			m.extents[id] = append(m.extents[id], e)
+		}
+	}
+	return br.err
+}
+
+func btoi(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// exifItem returns the ID of the Exif item describing the primary image, or the first Exif item.
+func (m *heifMeta) exifItem() (uint64, bool) {
+	var found []uint64
+	for id, typ := range m.types {
+		if typ == "Exif" && len(m.extents[id]) > 0 {
+			found = append(found, id)
+		}
+	}
+	if len(found) == 0 {
+		return 0, false
+	}
+	best := found[0]
+	for _, id := range found {
+		for _, to := range m.cdsc[id] {
+			if to == m.primary {
+				return id, true
+			}
+		}
+		if id < best {
+			best = id
+		}
+	}
+	return best, true
+}
+
+// isHeif tells whether the ftyp box at the start of the file names a HEIF based brand.
+func isHeif(r io.ReaderAt, size int64) bool {
+	box, err := readBox(r, 0, size)
+	if err != nil || box.typ != "ftyp" {
+		return false
+	}
+	b, err := boxData(r, box, 0)
+	if err != nil || len(b) < 4 {
+		return false
+	}
+	// major brand, minor version and compatible brands
+	if heifBrands.contains(string(b[0:4])) {
+		return true
+	}
+	for i := 8; i+4 <= len(b); i += 4 {
+		if heifBrands.contains(string(b[i : i+4])) {
+			return true
+		}
+	}
+	return false
+}
+
+// heifExif locates the Exif item of the HEIF, HEIC or AVIF image of the given size read through r.
+// It returns the reader holding the TIFF structure, its size and the offset of the TIFF header.
+// The item data starts with the offset of the TIFF header from the end of this 4 bytes field,
+// usually skipping an "Exif\0\0" prefix.
+func heifExif(r io.ReaderAt, size int64) (io.ReaderAt, int64, int64, error) {
+	boxes, err := readBoxes(r, 0, size)
+	if err != nil {
+		return nil, 0, 0, err
+	}
+	var meta *bmffBox
+	for _, box := range boxes {
+		if box.typ == "meta" {
+			meta = box
+			break
+		}
+	}
+	if meta == nil {
+		return nil, 0, 0, ErrNoExif
+	}
+	m, err := parseMeta(r, meta, size)
+	if err != nil {
+		return nil, 0, 0, err
+	}
+	id, ok := m.exifItem()
+	if !ok {
+		return nil, 0, 0, ErrNoExif
+	}
+
+	// the item data, read in place when it is made of a single extent
+	src, start, end := r, int64(0), int64(0)
+	if extents := m.extents[id]; len(extents) == 1 {
+		start, end = extents[0].offset, extents[0].offset+extents[0].length
+		if start < 0 || end > size || end < start {
+			return nil, 0, 0, newFormatError(nil, start, extents[0].length, size)
+		}
+	} else {
+		var buf []byte
+		for _, e := range extents {
+			if e.offset < 0 || e.offset+e.length > size || e.length < 0 || int64(len(buf))+e.length > maxBoxData {
+				return nil, 0, 0, newFormatError(nil, e.offset, e.length, size)
+			}
+			b := make([]byte, e.length)
+			if _, err := r.ReadAt(b, e.offset); err != nil {
+				return nil, 0, 0, newFormatError(err, e.offset, e.length, size)
+			}
+			buf = append(buf, b...)
+		}
+		src, end = bytes.NewReader(buf), int64(len(buf))
+	}
+
+	prefix := make([]byte, 4)
+	if _, err := src.ReadAt(prefix, start); err != nil {
+		return nil, 0, 0, newFormatError(err, start, 4, end)
+	}
+	offset := start + 4 + int64(binary.BigEndian.Uint32(prefix))
+	// tolerate writers leaving the Exif prefix out of the offset
+	b := make([]byte, len(exifPrefix))
+	if _, err := src.ReadAt(b, offset); err == nil && string(b) == exifPrefix {
+		offset += int64(len(exifPrefix))
+	}
+	if offset >= end {
+		return nil, 0, 0, newFormatError(nil, offset, 1, end)
+	}
+	return src, end, offset, nil
+}
+
+// jxlSignature starts a JPEG XL file in the ISOBMFF container form, a bare codestream starts with 0xFF0A.
+const jxlSignature = "\x00\x00\x00\x0CJXL \x0D\x0A\x87\x0A"
+
+// jxlExif locates the Exif box of the JPEG XL container of the given size read through r.
+// It returns the reader holding the TIFF structure, its size and the offset of the TIFF header.
+// Like the HEIF Exif item, the box starts with the offset of the TIFF header from the end of
+// this 4 bytes field. An Exif box compressed in a brob box is reported with ErrBrotli, the
+// standard library has no Brotli decoder.
+func jxlExif(r io.ReaderAt, size int64) (io.ReaderAt, int64, int64, error) {
+	boxes, err := readBoxes(r, 0, size)
+	if err != nil {
+		return nil, 0, 0, err
+	}
+	compressed := false
+	for _, box := range boxes {
+		switch box.typ {
+		case "Exif":
+			prefix := make([]byte, 4)
+			if _, err := r.ReadAt(prefix, box.data); err != nil {
+				return nil, 0, 0, newFormatError(err, box.data, 4, box.end)
+			}
+			offset := box.data + 4 + int64(binary.BigEndian.Uint32(prefix))
+			if offset >= box.end {
+				return nil, 0, 0, newFormatError(nil, offset, 1, box.end)
+			}
+			return r, box.end, offset, nil
+		case "brob":
+			// the type of the compressed box precedes the Brotli stream
+			typ := make([]byte, 4)
+			if _, err := r.ReadAt(typ, box.data); err == nil && string(typ) == "Exif" {
+				compressed = true
+			}
+		}
+	}
+	if compressed {
+		return nil, 0, 0, ErrBrotli
+	}
+	return nil, 0, 0, ErrNoExif
+}
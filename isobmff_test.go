@@ -0,0 +1,124 @@
+package exif4go
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+)
+
+// box returns an ISO base media file format box holding the payload parts.
+func box(typ string, parts ...[]byte) []byte {
+	b := make([]byte, 8)
+	copy(b[4:], typ)
+	for _, p := range parts {
+		b = append(b, p...)
+	}
+	binary.BigEndian.PutUint32(b, uint32(len(b)))
+	return b
+}
+
+// u16 and u32 return big endian integers
+func u16(v int) []byte { return binary.BigEndian.AppendUint16(nil, uint16(v)) }
+func u32(v int) []byte { return binary.BigEndian.AppendUint32(nil, uint32(v)) }
+
+// heifImage returns a HEIF file whose Exif item holds blob, stored in mdat or, with
+// idat set, in the meta box.
+func heifImage(brand string, blob []byte, idat bool) []byte {
+	// exif_tiff_header_offset and the Exif prefix precede the TIFF header
+	item := append(append(u32(6), exifPrefix...), blob...)
+	ftyp := box("ftyp", []byte(brand), u32(0), []byte("mif1"), []byte(brand))
+	full := []byte{0, 0, 0, 0}
+	iinf := box("iinf", full, u16(2),
+		box("infe", []byte{2, 0, 0, 0}, u16(1), u16(0), []byte("hvc1"), []byte{0}),
+		box("infe", []byte{2, 0, 0, 0}, u16(2), u16(0), []byte("Exif"), []byte{0}))
+	iref := box("iref", full, box("cdsc", u16(2), u16(1), u16(1)))
+	iloc := func(offset int) []byte {
+		method := 0
+		if idat {
+			method = 1
+		}
+		// version 1, 4 bytes offsets and lengths, no base offset
+		return box("iloc", []byte{1, 0, 0, 0}, []byte{0x44, 0x00}, u16(1),
+			u16(2), u16(method), u16(0), u16(1), u32(offset), u32(len(item)))
+	}
+	meta := func(offset int) []byte {
+		parts := [][]byte{full, box("hdlr", full, u32(0), []byte("pict"), make([]byte, 13)),
+			box("pitm", full, u16(1)), iinf, iref, iloc(offset)}
+		if idat {
+			parts = append(parts, box("idat", item))
+		}
+		return box("meta", parts...)
+	}
+	if idat {
+		return append(append(ftyp, meta(0)...), box("mdat")...)
+	}
+	// the item follows the mdat header, whose position does not depend on the offset
+	at := len(ftyp) + len(meta(0)) + 8
+	return append(append(ftyp, meta(at)...), box("mdat", item)...)
+}
+
+func TestHeif(t *testing.T) {
+	ts := &TagSet{Image: []*IfdTag{NewASCIITag(0x010F, "Apple"), NewASCIITag(0x0110, "iPhone 12")}}
+	blob, err := Encode(ts, binary.BigEndian)
+	if err != nil {
+		t.Fatalf("Error encoding: %s", err)
+	}
+	images := map[string][]byte{
+		"HEIC": heifImage("heic", blob, false),
+		"AVIF": heifImage("avif", blob, true),
+	}
+	for name, b := range images {
+		x, err := Decode(bytes.NewReader(b), int64(len(b)), nil)
+		if err != nil {
+			t.Errorf("Error decoding the %s image: %s", name, err)
+			continue
+		}
+		if tag, ok := x.Tags["Image Model"]; !ok || tag.Printable != `"iPhone 12"` {
+			t.Errorf("Expected the model in the %s image, got %v", name, tag)
+		}
+	}
+
+	// no Exif item
+	b := append(box("ftyp", []byte("heic"), u32(0), []byte("mif1")), box("meta", []byte{0, 0, 0, 0})...)
+	if _, err := Decode(bytes.NewReader(b), int64(len(b)), nil); err != ErrNoExif {
+		t.Errorf("Expected ErrNoExif, got %v", err)
+	}
+	// not a HEIF brand
+	b = box("ftyp", []byte("isom"), u32(0), []byte("mp41"))
+	if _, err := Decode(bytes.NewReader(b), int64(len(b)), nil); err != ErrUnknownFormat {
+		t.Errorf("Expected ErrUnknownFormat, got %v", err)
+	}
+}
+
+func TestJPEGXL(t *testing.T) {
+	ts := &TagSet{Image: []*IfdTag{NewASCIITag(0x010F, "Canon"), NewASCIITag(0x0110, "Canon EOS 1000D")}}
+	blob, err := Encode(ts, binary.LittleEndian)
+	if err != nil {
+		t.Fatalf("Error encoding: %s", err)
+	}
+	sig := []byte(jxlSignature)
+	ftyp := box("ftyp", []byte("jxl "), u32(0), []byte("jxl "))
+	codestream := box("jxlc", []byte{0xFF, 0x0A, 0, 0})
+
+	b := bytes.Join([][]byte{sig, ftyp, box("Exif", u32(0), blob), codestream}, nil)
+	x, err := Decode(bytes.NewReader(b), int64(len(b)), nil)
+	if err != nil {
+		t.Fatalf("There was an error: %s", err)
+	}
+	if tag, ok := x.Tags["Image Model"]; !ok || tag.Printable != `"Canon EOS 1000D"` {
+		t.Errorf("Expected the model, got %v", tag)
+	}
+
+	b = bytes.Join([][]byte{sig, ftyp, box("brob", []byte("Exif"), []byte{0x8B, 0x02}), codestream}, nil)
+	if _, err := Decode(bytes.NewReader(b), int64(len(b)), nil); err != ErrBrotli {
+		t.Errorf("Expected ErrBrotli, got %v", err)
+	}
+	b = bytes.Join([][]byte{sig, ftyp, codestream}, nil)
+	if _, err := Decode(bytes.NewReader(b), int64(len(b)), nil); err != ErrNoExif {
+		t.Errorf("Expected ErrNoExif, got %v", err)
+	}
+	b = []byte("\xFF\x0A\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00")
+	if _, err := Decode(bytes.NewReader(b), int64(len(b)), nil); err != ErrNoExif {
+		t.Errorf("Expected ErrNoExif for a bare codestream, got %v", err)
+	}
+}
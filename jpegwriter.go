@@ -0,0 +1,194 @@
+package exif4go
+
+import (
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// JPEG markers
+const (
+	markerSOI  = 0xD8
+	markerEOI  = 0xD9
+	markerSOS  = 0xDA
+	markerAPP0 = 0xE0
+	markerAPP1 = 0xE1
+)
+
+// exifPrefix starts the payload of the Exif APP1 segment, the TIFF header follows it.
+const exifPrefix = "Exif\x00\x00"
+
+// jpegSegment is a marker segment of a JPEG file.
+type jpegSegment struct {
+	marker byte
+	// position of the 0xFF byte starting the marker
+	offset int64
+	// size of the segment including the marker and the length field
+	length int64
+	// first bytes of the payload, enough to recognise the APPn identifiers
+	ident []byte
+}
+
+// readJpegSegment reads the marker segment starting at offset, fill bytes before the marker are skipped.
+// A segment running past size is returned along with the error.
+func readJpegSegment(r io.ReaderAt, offset int64, size int64) (*jpegSegment, error) {
+	b := make([]byte, 1)
+	for {
+		if _, err := r.ReadAt(b, offset); err != nil {
+			return nil, newFormatError(err, offset, 1, size)
+		}
+		if b[0] != 0xFF {
+			return nil, &FormatError{Tag: -1, Offset: offset, Err: errors.New("missing JPEG marker")}
+		}
+		if _, err := r.ReadAt(b, offset+1); err != nil {
+			return nil, newFormatError(err, offset+1, 1, size)
+		}
+		if b[0] != 0xFF {
+			break
+		}
+		offset++
+	}
+	seg := &jpegSegment{marker: b[0], offset: offset, length: 2}
+	if seg.marker == markerSOI || seg.marker == markerEOI || (0xD0 <= seg.marker && seg.marker <= 0xD7) || seg.marker == 0x01 {
+		// standalone markers carry no length
+		return seg, nil
+	}
+	hdr := make([]byte, 2+len(exifPrefix))
+	n, err := r.ReadAt(hdr, offset+2)
+	if n < 2 {
+		return nil, newFormatError(err, offset+2, 2, size)
+	}
+	seg.length = 2 + int64(hdr[0])<<8 + int64(hdr[1])
+	if seg.length < 4 {
+		return nil, newFormatError(nil, offset, seg.length, size)
+	}
+	if l := int(seg.length) - 4; l < n-2 {
+		n = l + 2
+	}
+	seg.ident = hdr[2:n]
+	if offset+seg.length > size {
+		return seg, newFormatError(nil, offset, seg.length, size)
+	}
+	return seg, nil
+}
+
+// isExif tells whether the segment is an Exif APP1 segment.
+func (seg *jpegSegment) isExif() bool {
+	return seg.marker == markerAPP1 && string(seg.ident) == exifPrefix
+}
+
+// jpegExif returns the position of the TIFF header held by the first Exif APP1 segment of the
+// JPEG image, which may follow any other segment, such as JFIF, ICC profile or XMP ones.
+// A truncated Exif segment is returned too, its TIFF structure is decoded as far as it goes.
+func jpegExif(r io.ReaderAt, size int64) (int64, error) {
+	offset := int64(2)
+	for {
+		seg, err := readJpegSegment(r, offset, size)
+		if seg != nil && seg.isExif() {
+			return seg.offset + 4 + int64(len(exifPrefix)), nil
+		}
+		if err != nil {
+			return 0, err
+		}
+		if seg.marker == markerSOS || seg.marker == markerEOI {
+			return 0, ErrNoExif
+		}
+		offset = seg.offset + seg.length
+	}
+}
+
+// WriteJPEG copies the JPEG image of the given size read through r to w, replacing its
+// Exif APP1 segment with the TIFF structured EXIF block exif, e.g. one returned by Encode.
+// When the image has no Exif segment one is inserted after the JFIF/JFXX APP0 segments,
+// a nil exif removes the Exif segment. All the other segments and the entropy-coded image
+// data are copied byte for byte, so the image is not recompressed.
+func WriteJPEG(w io.Writer, r io.ReaderAt, size int64, exif []byte) error {
+	var app1 []byte
+	if exif != nil {
+		length := 2 + len(exifPrefix) + len(exif)
+		if length > 0xFFFF {
+			return errors.New("EXIF data too large for a JPEG APP1 segment")
+		}
+		app1 = append([]byte{0xFF, markerAPP1, byte(length >> 8), byte(length)}, exifPrefix...)
+		app1 = append(app1, exif...)
+	}
+
+	sr := io.NewSectionReader(r, 0, size)
+	soi := make([]byte, 2)
+	if _, err := sr.ReadAt(soi, 0); err != nil || string(soi) != "\xFF\xD8" {
+		return ErrUnknownFormat
+	}
+	if _, err := w.Write(soi); err != nil {
+		return err
+	}
+
+	written := false
+	offset := int64(2)
+	for {
+		seg, err := readJpegSegment(sr, offset, size)
+		if err != nil {
+			return err
+		}
+		if seg.isExif() {
+			// the new Exif segment replaces the first one, any other is dropped
+			if !written {
+				if _, err := w.Write(app1); err != nil {
+					return err
+				}
+				written = true
+			}
+			offset = seg.offset + seg.length
+			continue
+		}
+		if !written && seg.marker != markerAPP0 {
+			// no Exif segment so far, insert it after the APP0 segments
+			if _, err := w.Write(app1); err != nil {
+				return err
+			}
+			written = true
+		}
+		if seg.marker == markerSOS || seg.marker == markerEOI {
+			// copy the scan and everything following it as is
+			_, err := io.Copy(w, io.NewSectionReader(sr, seg.offset, size-seg.offset))
+			return err
+		}
+		if _, err := io.Copy(w, io.NewSectionReader(sr, seg.offset, seg.length)); err != nil {
+			return err
+		}
+		offset = seg.offset + seg.length
+	}
+}
+
+// RewriteJPEGFile replaces the EXIF information of the JPEG file name with exif, see WriteJPEG.
+// The new image is written to a temporary file in the same directory which then replaces the original.
+func RewriteJPEGFile(name string, exif []byte) error {
+	f, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return err
+	}
+
+	tmp, err := ioutil.TempFile(filepath.Dir(name), "."+filepath.Base(name))
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if err := WriteJPEG(tmp, f, fi.Size(), exif); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Chmod(fi.Mode()); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), name)
+}
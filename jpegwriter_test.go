@@ -0,0 +1,159 @@
+package exif4go
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// scanData returns the image data starting at the SOS marker.
+func scanData(t *testing.T, b []byte) []byte {
+	offset := int64(2)
+	for {
+		seg, err := readJpegSegment(bytes.NewReader(b), offset, int64(len(b)))
+		if err != nil {
+			t.Fatal("No SOS marker found:", err)
+		}
+		if seg.marker == markerSOS {
+			return b[seg.offset:]
+		}
+		offset = seg.offset + seg.length
+	}
+}
+
+func TestWriteJPEG(t *testing.T) {
+	fpath := "./test/test.jpg"
+	orig, err := ioutil.ReadFile(fpath)
+	if err != nil {
+		t.Fatal("Error reading file:", fpath)
+	}
+	x, err := Decode(bytes.NewReader(orig), int64(len(orig)), nil)
+	if err != nil {
+		t.Fatalf("There was an error: %s", err)
+	}
+	tags := x.Tags
+	ts := NewTagSet(tags)
+	ts.Image = append(ts.Image, NewASCIITag(0x8298, "Copyright holder"))
+	exif, err := Encode(ts, binary.LittleEndian)
+	if err != nil {
+		t.Fatalf("There was an error: %s", err)
+	}
+
+	// replace the Exif segment
+	var buf bytes.Buffer
+	if err := WriteJPEG(&buf, bytes.NewReader(orig), int64(len(orig)), exif); err != nil {
+		t.Fatalf("There was an error: %s", err)
+	}
+	replaced := buf.Bytes()
+	if !bytes.Equal(scanData(t, replaced), scanData(t, orig)) {
+		t.Error("The image data was modified")
+	}
+	x, err = Decode(bytes.NewReader(replaced), int64(len(replaced)), nil)
+	if err != nil {
+		t.Fatalf("Error decoding the written image: %s", err)
+	}
+	written := x.Tags
+	if tag, ok := written["Image Copyright"]; !ok || tag.Printable != `"Copyright holder"` {
+		t.Errorf("The copyright is missing: %v", tag)
+	}
+	if tag := written["Image Model"]; tag == nil || tag.Printable != tags["Image Model"].Printable {
+		t.Errorf("The model was not preserved: %v", tag)
+	}
+
+	// remove it
+	buf.Reset()
+	if err := WriteJPEG(&buf, bytes.NewReader(orig), int64(len(orig)), nil); err != nil {
+		t.Fatalf("There was an error: %s", err)
+	}
+	stripped := append([]byte(nil), buf.Bytes()...)
+	if _, err := Decode(bytes.NewReader(stripped), int64(len(stripped)), nil); err != ErrNoExif {
+		t.Errorf("Expected ErrNoExif after removing the Exif segment, got %v", err)
+	}
+
+	// and insert it again
+	buf.Reset()
+	if err := WriteJPEG(&buf, bytes.NewReader(stripped), int64(len(stripped)), exif); err != nil {
+		t.Fatalf("There was an error: %s", err)
+	}
+	if !bytes.Equal(buf.Bytes(), replaced) {
+		t.Error("Inserting the Exif segment does not give the same image as replacing it")
+	}
+}
+
+func TestRewriteJPEGFile(t *testing.T) {
+	orig, err := ioutil.ReadFile("./test/test.jpg")
+	if err != nil {
+		t.Fatal("Error reading file:", err)
+	}
+	dir, err := ioutil.TempDir("", "exif4go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	fpath := filepath.Join(dir, "test.jpg")
+	if err := ioutil.WriteFile(fpath, orig, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	ts := &TagSet{Image: []*IfdTag{NewASCIITag(0x013B, "Somebody")}}
+	exif, err := Encode(ts, binary.BigEndian)
+	if err != nil {
+		t.Fatalf("There was an error: %s", err)
+	}
+	if err := RewriteJPEGFile(fpath, exif); err != nil {
+		t.Fatalf("There was an error: %s", err)
+	}
+
+	f, err := os.Open(fpath)
+	if err != nil {
+		t.Fatal("Error opening file:", fpath)
+	}
+	defer f.Close()
+	tags, err := Process(f, false)
+	if err != nil {
+		t.Fatalf("There was an error: %s", err)
+	}
+	if len(tags) != 1 || tags["Image Artist"] == nil || tags["Image Artist"].Printable != `"Somebody"` {
+		t.Errorf("Unexpected tags after rewriting the file: %v", tags)
+	}
+}
+
+func TestJPEGExifSegment(t *testing.T) {
+	exif, err := Encode(&TagSet{Image: []*IfdTag{NewASCIITag(0x010F, "Canon")}}, binary.BigEndian)
+	if err != nil {
+		t.Fatalf("Error encoding: %s", err)
+	}
+	segment := func(marker byte, payload string) []byte {
+		return append([]byte{0xFF, marker, byte((len(payload) + 2) >> 8), byte(len(payload) + 2)}, payload...)
+	}
+	// the Exif segment follows an ICC profile and an XMP packet
+	var b []byte
+	b = append(b, 0xFF, markerSOI)
+	b = append(b, segment(markerAPP0, "JFIF\x00\x01\x01\x00\x00\x01\x00\x01\x00\x00")...)
+	b = append(b, segment(0xE2, "ICC_PROFILE\x00\x01\x01")...)
+	b = append(b, segment(markerAPP1, "http://ns.adobe.com/xap/1.0/\x00<x:xmpmeta/>")...)
+	b = append(b, segment(markerAPP1, exifPrefix+string(exif))...)
+	b = append(b, segment(markerSOS, "\x01\x01\x00\x00\x3F\x00")...)
+	b = append(b, 0xFF, markerEOI)
+
+	x, err := Decode(bytes.NewReader(b), int64(len(b)), &Options{Strict: true})
+	if err != nil {
+		t.Fatalf("There was an error: %s", err)
+	}
+	if tag, ok := x.Tags["Image Make"]; !ok || tag.Printable != `"Canon"` {
+		t.Errorf("Expected the Canon make, got %v", tag)
+	}
+
+	// no Exif segment before the scan
+	var buf bytes.Buffer
+	if err := WriteJPEG(&buf, bytes.NewReader(b), int64(len(b)), nil); err != nil {
+		t.Fatalf("There was an error: %s", err)
+	}
+	stripped := append(buf.Bytes(), segment(markerAPP1, exifPrefix+string(exif))...)
+	if _, err := Decode(bytes.NewReader(stripped), int64(len(stripped)), nil); err != ErrNoExif {
+		t.Errorf("Expected ErrNoExif, got %v", err)
+	}
+}
@@ -0,0 +1,108 @@
+package exif4go
+
+import (
+	"bytes"
+	"strconv"
+	"strings"
+)
+
+// decodeMakerNote processes the MakerNote contained in the EXIF IFD according to the camera make,
+// the tags found are stored with the "MakerNote" IFD name and returned as the "MakerNote" IFD.
+// Makes without a known format are left alone.
+func (eh *exifHeader) decodeMakerNote() (*Ifd, error) {
+	note := eh.tags["EXIF MakerNote"]
+	maker, err := eh.tags["Image Make"].StringVal()
+	if err != nil {
+		return nil, nil
+	}
+
+	switch {
+	case strings.HasPrefix(strings.ToUpper(maker), "NIKON"):
+		return eh.decodeNikonMakerNote(note)
+	case strings.HasPrefix(maker, "Canon"):
+		eh.opts.writeInfo(" Canon MakerNote at offset", note.fieldoffset)
+		ifd, err := eh.dumpMakerNote(note.fieldoffset, makerNoteCanonTags)
+		if err != nil {
+			return ifd, err
+		}
+		if t, ok := ifd.Tags["CameraSettings"]; ok {
+			eh.canonDecodeTag(t, makerNoteCanonTags_0x001)
+		}
+		if t, ok := ifd.Tags["ShotInfo"]; ok {
+			eh.canonDecodeTag(t, makerNoteCanonTags_0x004)
+		}
+		return ifd, nil
+	}
+	return nil, nil
+}
+
+// decodeNikonMakerNote processes the three known layouts of the Nikon MakerNote.
+func (eh *exifHeader) decodeNikonMakerNote(note *IfdTag) (*Ifd, error) {
+	switch {
+	case bytes.HasPrefix(note.raw, []byte("Nikon\x00\x01")):
+		// type 1: the IFD follows an 8 bytes label,
+		// offsets are relative to the EXIF TIFF header
+		eh.opts.writeInfo(" Nikon type 1 MakerNote at offset", note.fieldoffset)
+		return eh.dumpMakerNote(note.fieldoffset+8, makerNoteNikonOldTags)
+	case bytes.HasPrefix(note.raw, []byte("Nikon\x00\x02")):
+		// type 3: a 10 bytes label is followed by a complete TIFF header,
+		// offsets and byte order are the ones of this embedded header
+		eh.opts.writeInfo(" Nikon type 3 MakerNote at offset", note.fieldoffset)
+		sub, err := eh.subHeader(note.fieldoffset + 10)
+		if err != nil {
+			return nil, err
+		}
+		ifd, err := sub.firstIfd()
+		if err != nil {
+			return nil, err
+		}
+		return sub.dumpMakerNote(ifd, makerNoteNikonTags)
+	default:
+		// type 2 (E99x, D1): a bare IFD, offsets are relative to the EXIF TIFF header
+		eh.opts.writeInfo(" Nikon type 2 MakerNote at offset", note.fieldoffset)
+		return eh.dumpMakerNote(note.fieldoffset, makerNoteNikonTags)
+	}
+}
+
+// dumpMakerNote decodes the MakerNote IFD at offset ifd. The IFD is returned with the tags read
+// before an error.
+func (eh *exifHeader) dumpMakerNote(ifd int, dict map[int]*exifTag) (*Ifd, error) {
+	err := eh.dumpIfd(ifd, "MakerNote", dict, eh.opts.StopTag)
+	return eh.takeIfd("MakerNote", eh.offset+int64(ifd), dict), err
+}
+
+// canonDecodeTag expands the items of a Canon array tag into separate tags named by dict,
+// which is indexed by item position. The first item holds the array size in bytes and is skipped.
+// The tags take the item position as ID and are only stored in Exif.Tags: they are not entries
+// of the MakerNote IFD and have no TagKey.
+func (eh *exifHeader) canonDecodeTag(t *IfdTag, dict map[int]*exifTag) {
+	ft := FieldTypeOf(t.Fieldtype)
+	if ft == nil {
+		return
+	}
+	size := int(ft.Size)
+	for i := 1; i < t.Count(); i++ {
+		entry, ok := dict[i]
+		if !ok {
+			continue
+		}
+		v, err := t.Uint(i)
+		if err != nil {
+			return
+		}
+		tag := newTag(i, t.Fieldtype, 1, t.raw[i*size:(i+1)*size], t.order)
+		tag.fieldoffset = t.fieldoffset + i*size
+		if t.ValueOffset >= 0 {
+			tag.ValueOffset = t.ValueOffset + int64(i*size)
+		}
+		if entry.fields != nil {
+			if s, ok := entry.fields[int(v)]; ok {
+				tag.Printable = s
+			} else {
+				tag.Printable = "Unknown (" + strconv.FormatUint(v, 10) + ")"
+			}
+		}
+		eh.tags["MakerNote "+entry.name] = tag
+		eh.opts.writeInfo(" DEBUG:   "+entry.name+":", tag)
+	}
+}
@@ -0,0 +1,151 @@
+package exif4go
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"testing"
+)
+
+func TestCanonMakerNote(t *testing.T) {
+	fpath := "./test/test.jpg"
+	f, err := os.Open(fpath)
+	if err != nil {
+		t.Fatal("Error opening file:", fpath)
+	}
+	defer f.Close()
+	fi, _ := f.Stat()
+	x, err := Decode(f, fi.Size(), &Options{Details: true})
+	if err != nil {
+		t.Fatalf("There was an error: %s", err)
+	}
+	tags := x.Tags
+
+	expected := map[string]string{
+		"MakerNote FirmwareVersion":                    `"Firmware Version 1.0.6"`,
+		"MakerNote ImageType":                          `"Canon EOS 1000D"`,
+		"MakerNote FocusMode":                          "One-Shot",
+		"MakerNote Quality":                            "Fine",
+		"MakerNote MeteringMode":                       "Evaluative",
+		"MakerNote ShortFocalLengthOfLensInFocalUnits": "18",
+		"MakerNote WhiteBalance":                       "Auto",
+		"MakerNote FlashBias":                          "0 EV",
+	}
+	for k, v := range expected {
+		if tag, ok := tags[k]; !ok {
+			t.Errorf("The key %s is missing", k)
+		} else if tag.Printable != v {
+			t.Errorf("The value of %s is %s, expected %s", k, tag.Printable, v)
+		}
+	}
+	if v, err := tags["MakerNote LongFocalLengthOfLensInFocalUnits"].Int(0); err != nil || v != 55 {
+		t.Errorf("LongFocalLengthOfLensInFocalUnits is %d (%v), expected 55", v, err)
+	}
+
+	// the MakerNote IFD is listed after the EXIF IFD
+	var names []string
+	var note *Ifd
+	for _, ifd := range x.IfdList() {
+		names = append(names, ifd.Name)
+		if ifd.Name == "MakerNote" {
+			note = ifd
+		}
+	}
+	if note == nil || note.Tags["FirmwareVersion"] != tags["MakerNote FirmwareVersion"] {
+		t.Fatalf("Expected the MakerNote IFD, got the %v IFDs", names)
+	}
+	// the expanded array items are only in Tags, with their position as ID
+	if _, ok := note.Tags["FocusMode"]; ok || tags["MakerNote FocusMode"].ID() != 7 {
+		t.Errorf("Expected FocusMode as the 7th item of CameraSettings, got %v", tags["MakerNote FocusMode"])
+	}
+	exif := x.Ifds[0].Children[0]
+	if exif.Name != "EXIF" || exif.Children[len(exif.Children)-1] != note {
+		t.Errorf("Expected the MakerNote IFD to be a child of the EXIF IFD, got the %v IFDs", names)
+	}
+
+	// the MakerNote is only decoded with details
+	x, err = Decode(f, fi.Size(), nil)
+	if err != nil {
+		t.Fatalf("There was an error: %s", err)
+	}
+	tags = x.Tags
+	if _, ok := tags["MakerNote FocusMode"]; ok {
+		t.Error("The MakerNote was decoded without details")
+	}
+}
+
+// nikonImage returns a TIFF image of a Nikon camera holding the given MakerNote.
+func nikonImage(t *testing.T, note []byte, order binary.ByteOrder) map[string]*IfdTag {
+	b, err := Encode(&TagSet{
+		Image: []*IfdTag{NewASCIITag(0x010F, "NIKON CORPORATION")},
+		Exif:  []*IfdTag{NewUndefinedTag(0x927C, note)},
+	}, order)
+	if err != nil {
+		t.Fatalf("There was an error: %s", err)
+	}
+	x, err := Decode(bytes.NewReader(b), int64(len(b)), &Options{Details: true})
+	if err != nil {
+		t.Fatalf("There was an error: %s", err)
+	}
+	tags := x.Tags
+	return tags
+}
+
+func TestNikonMakerNote(t *testing.T) {
+	// type 3, with its own TIFF header in a byte order different from the main one
+	embedded, err := Encode(&TagSet{Image: []*IfdTag{
+		NewShortTag(0x0002, 0, 400),
+		NewASCIITag(0x0004, "FINE"),
+		NewASCIITag(0x0005, "AUTO"),
+		NewASCIITag(0x001D, "3012345"),
+		NewByteTag(0x0083, 0x0E),
+		NewASCIITag(0x00A0, "NO= 3012345"),
+		NewLongTag(0x00A7, 12345),
+	}}, binary.BigEndian)
+	if err != nil {
+		t.Fatalf("There was an error: %s", err)
+	}
+	tags := nikonImage(t, append([]byte("Nikon\x00\x02\x10\x00\x00"), embedded...), binary.LittleEndian)
+	expected := map[string]string{
+		"MakerNote ISO":                "400",
+		"MakerNote Quality":            `"FINE"`,
+		"MakerNote WhiteBalance":       `"AUTO"`,
+		"MakerNote SerialNumber":       `"3012345"`,
+		"MakerNote LensType":           "D G VR",
+		"MakerNote LegacySerialNumber": `"NO= 3012345"`,
+		"MakerNote ShutterCount":       "12345",
+	}
+	for k, v := range expected {
+		if tag, ok := tags[k]; !ok {
+			t.Errorf("The key %s is missing", k)
+		} else if tag.Printable != v {
+			t.Errorf("The value of %s is %s, expected %s", k, tag.Printable, v)
+		}
+	}
+
+	// type 1, a bare IFD following the label
+	order := binary.BigEndian
+	note := []byte("Nikon\x00\x01\x00")
+	ifd := make([]byte, 2+3*12+4)
+	order.PutUint16(ifd, 3)
+	for i, e := range [][2]uint16{{0x0003, 3}, {0x0006, 5}, {0x0007, 2}} {
+		entry := ifd[2+12*i:]
+		order.PutUint16(entry, e[0])
+		order.PutUint16(entry[2:], 3)
+		order.PutUint32(entry[4:], 1)
+		order.PutUint16(entry[8:], e[1])
+	}
+	tags = nikonImage(t, append(note, ifd...), order)
+	expected = map[string]string{
+		"MakerNote Quality":      "VGA Fine",
+		"MakerNote CCDSpeed":     "ISO 100",
+		"MakerNote WhiteBalance": "Daylight",
+	}
+	for k, v := range expected {
+		if tag, ok := tags[k]; !ok {
+			t.Errorf("The key %s is missing", k)
+		} else if tag.Printable != v {
+			t.Errorf("The value of %s is %s, expected %s", k, tag.Printable, v)
+		}
+	}
+}
@@ -0,0 +1,143 @@
+package exif4go
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/hex"
+	"errors"
+	"io"
+	"io/ioutil"
+	"strconv"
+	"strings"
+)
+
+// pngSignature starts every PNG file.
+const pngSignature = "\x89PNG\r\n\x1A\n"
+
+// maxPngText bounds the size of a decompressed text chunk holding a raw EXIF profile.
+const maxPngText = 1 << 24
+
+// pngExif locates the EXIF information of the PNG image of the given size read through r.
+// It returns the reader holding the TIFF structure, its size and the offset of the TIFF header.
+// The eXIf chunk is read in place; the legacy "Raw profile type exif" text chunks written by
+// ImageMagick and exiftool hold the EXIF information as hexadecimal text and are decoded in memory.
+func pngExif(r io.ReaderAt, size int64) (io.ReaderAt, int64, int64, error) {
+	var legacy []byte
+	offset := int64(len(pngSignature))
+chunks:
+	for offset+8 <= size {
+		hdr := make([]byte, 8)
+		if _, err := r.ReadAt(hdr, offset); err != nil {
+			return nil, 0, 0, newFormatError(err, offset, 8, size)
+		}
+		length := int64(hdr[0])<<24 | int64(hdr[1])<<16 | int64(hdr[2])<<8 | int64(hdr[3])
+		data := offset + 8
+		if data+length+4 > size {
+			return nil, 0, 0, newFormatError(nil, data, length+4, size)
+		}
+		switch string(hdr[4:8]) {
+		case "eXIf":
+			// some writers keep the JPEG APP1 prefix
+			prefix := make([]byte, len(exifPrefix))
+			if length >= int64(len(prefix)) {
+				if _, err := r.ReadAt(prefix, data); err == nil && string(prefix) == exifPrefix {
+					data += int64(len(prefix))
+				}
+			}
+			return r, offset + 8 + length, data, nil
+		case "zTXt", "tEXt", "iTXt":
+			if legacy != nil || length > maxPngText {
+				break
+			}
+			chunk := make([]byte, length)
+			if _, err := r.ReadAt(chunk, data); err != nil {
+				return nil, 0, 0, newFormatError(err, data, length, size)
+			}
+			legacy = pngRawProfile(string(hdr[4:8]), chunk)
+		case "IEND":
+			break chunks
+		}
+		// skip the data and the CRC
+		offset = data + length + 4
+	}
+	if legacy == nil {
+		return nil, 0, 0, ErrNoExif
+	}
+	// the profile is an APP1 payload, the TIFF header follows the Exif prefix
+	start := int64(0)
+	if bytes.HasPrefix(legacy, []byte(exifPrefix)) {
+		start = int64(len(exifPrefix))
+	}
+	return bytes.NewReader(legacy), int64(len(legacy)), start, nil
+}
+
+// pngRawProfile returns the EXIF information of a "Raw profile type exif" or "Raw profile type APP1"
+// text chunk, nil for any other chunk.
+func pngRawProfile(kind string, chunk []byte) []byte {
+	i := bytes.IndexByte(chunk, 0)
+	if i < 0 {
+		return nil
+	}
+	keyword := string(chunk[:i])
+	if keyword != "Raw profile type exif" && keyword != "Raw profile type APP1" {
+		return nil
+	}
+	text := chunk[i+1:]
+	compressed := false
+	switch kind {
+	case "zTXt":
+		// compression method
+		if len(text) < 1 {
+			return nil
+		}
+		text, compressed = text[1:], true
+	case "iTXt":
+		// compression flag and method, language tag and translated keyword
+		if len(text) < 2 {
+			return nil
+		}
+		compressed = text[0] == 1
+		text = text[2:]
+		for n := 0; n < 2; n++ {
+			j := bytes.IndexByte(text, 0)
+			if j < 0 {
+				return nil
+			}
+			text = text[j+1:]
+		}
+	}
+	if compressed {
+		zr, err := zlib.NewReader(bytes.NewReader(text))
+		if err != nil {
+			return nil
+		}
+		if text, err = ioutil.ReadAll(io.LimitReader(zr, maxPngText)); err != nil {
+			return nil
+		}
+	}
+	b, err := decodeRawProfile(string(text))
+	if err != nil {
+		return nil
+	}
+	return b
+}
+
+// decodeRawProfile decodes the "\nexif\n    <length>\n<hex digits>" text of a raw profile.
+func decodeRawProfile(s string) ([]byte, error) {
+	fields := strings.Fields(s)
+	if len(fields) < 3 {
+		return nil, errors.New("malformed raw profile")
+	}
+	n, err := strconv.Atoi(fields[1])
+	if err != nil {
+		return nil, err
+	}
+	b, err := hex.DecodeString(strings.Join(fields[2:], ""))
+	if err != nil {
+		return nil, err
+	}
+	if len(b) != n {
+		return nil, errors.New("raw profile length mismatch")
+	}
+	return b, nil
+}
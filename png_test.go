@@ -0,0 +1,73 @@
+package exif4go
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"hash/crc32"
+	"image"
+	"image/png"
+	"testing"
+)
+
+// pngWithChunk returns a small PNG image holding an extra chunk after IHDR.
+func pngWithChunk(t *testing.T, kind string, data []byte) []byte {
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, image.NewGray(image.Rect(0, 0, 4, 4))); err != nil {
+		t.Fatalf("Error encoding the PNG image: %s", err)
+	}
+	b := buf.Bytes()
+	// signature and IHDR chunk
+	ihdr := len(pngSignature) + 8 + 13 + 4
+	chunk := make([]byte, 8, 12+len(data))
+	binary.BigEndian.PutUint32(chunk, uint32(len(data)))
+	copy(chunk[4:], kind)
+	chunk = append(chunk, data...)
+	chunk = binary.BigEndian.AppendUint32(chunk, crc32.ChecksumIEEE(chunk[4:]))
+	out := append([]byte(nil), b[:ihdr]...)
+	out = append(out, chunk...)
+	return append(out, b[ihdr:]...)
+}
+
+func TestPNG(t *testing.T) {
+	ts := &TagSet{Image: []*IfdTag{NewASCIITag(0x010F, "Canon"), NewASCIITag(0x0110, "Canon EOS 1000D")}}
+	blob, err := Encode(ts, binary.BigEndian)
+	if err != nil {
+		t.Fatalf("Error encoding: %s", err)
+	}
+
+	// raw profile, as written by ImageMagick
+	app1 := append([]byte(exifPrefix), blob...)
+	profile := fmt.Sprintf("\nexif\n%8d\n%s\n", len(app1), hex.EncodeToString(app1))
+	var z bytes.Buffer
+	zw := zlib.NewWriter(&z)
+	zw.Write([]byte(profile))
+	zw.Close()
+
+	images := map[string][]byte{
+		"eXIf":          pngWithChunk(t, "eXIf", blob),
+		"prefixed eXIf": pngWithChunk(t, "eXIf", app1),
+		"zTXt":          pngWithChunk(t, "zTXt", append([]byte("Raw profile type exif\x00\x00"), z.Bytes()...)),
+		"tEXt":          pngWithChunk(t, "tEXt", append([]byte("Raw profile type exif\x00"), profile...)),
+	}
+	for name, b := range images {
+		if _, err := png.Decode(bytes.NewReader(b)); err != nil {
+			t.Fatalf("Invalid %s test image: %s", name, err)
+		}
+		x, err := Decode(bytes.NewReader(b), int64(len(b)), nil)
+		if err != nil {
+			t.Errorf("Error decoding the %s image: %s", name, err)
+			continue
+		}
+		if tag, ok := x.Tags["Image Model"]; !ok || tag.Printable != `"Canon EOS 1000D"` {
+			t.Errorf("Expected the model in the %s image, got %v", name, tag)
+		}
+	}
+
+	plain := pngWithChunk(t, "tEXt", []byte("Comment\x00no EXIF here"))
+	if _, err := Decode(bytes.NewReader(plain), int64(len(plain)), nil); err != ErrNoExif {
+		t.Errorf("Expected ErrNoExif, got %v", err)
+	}
+}
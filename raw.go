@@ -0,0 +1,232 @@
+package exif4go
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"sort"
+	"strings"
+)
+
+// jpgFromRawTag holds the preview of Panasonic RW2 files.
+const jpgFromRawTag = 0x002E
+
+// rafSignature starts the Fujifilm RAF files.
+const rafSignature = "FUJIFILMCCD-RAW"
+
+// panasonicRawTags extends exifTags with the IFD0 tags of the Panasonic RW2 format.
+var panasonicRawTags = func() map[int]*exifTag {
+	m := make(map[int]*exifTag, len(exifTags)+10)
+	for k, v := range exifTags {
+		m[k] = v
+	}
+	m[0x0001] = &exifTag{"PanasonicRawVersion", nil, makestring}
+	m[0x0002] = &exifTag{"SensorWidth", nil, nil}
+	m[0x0003] = &exifTag{"SensorHeight", nil, nil}
+	m[0x0004] = &exifTag{"SensorTopBorder", nil, nil}
+	m[0x0005] = &exifTag{"SensorLeftBorder", nil, nil}
+	m[0x0006] = &exifTag{"SensorBottomBorder", nil, nil}
+	m[0x0007] = &exifTag{"SensorRightBorder", nil, nil}
+	m[0x0017] = &exifTag{"ISO", nil, nil}
+	m[jpgFromRawTag] = &exifTag{"JpgFromRaw", nil, nil}
+	return m
+}()
+
+// rawFormat identifies the TIFF based RAW formats from the 12 first bytes of the file
+// and the IFD0 tags. It returns "TIFF" for the other TIFF files.
+func rawFormat(data []byte, tags map[string]*IfdTag) string {
+	switch string(data[0:4]) {
+	case "IIRO", "IIRS", "MMOR":
+		return "ORF"
+	case "IIU\x00":
+		return "RW2"
+	}
+	if string(data[8:10]) == "CR" {
+		return "CR2"
+	}
+	if _, ok := tags["Image DNGVersion"]; ok {
+		return "DNG"
+	}
+	maker := ""
+	if t, ok := tags["Image Make"]; ok {
+		s, _ := t.StringVal()
+		maker = strings.ToUpper(s)
+	}
+	switch {
+	case strings.HasPrefix(maker, "NIKON"):
+		return "NEF"
+	case strings.HasPrefix(maker, "SONY"):
+		return "ARW"
+	case strings.HasPrefix(maker, "PENTAX"), strings.HasPrefix(maker, "RICOH"):
+		return "PEF"
+	}
+	return "TIFF"
+}
+
+// previewCandidate is an image embedded in the file, at an offset relative to the TIFF header.
+type previewCandidate struct {
+	offset int
+	length int
+}
+
+// previewCandidates lists the JPEG images referenced by the decoded IFDs: JPEGInterchangeFormat
+// tags, single strip JPEG compressed images and the RW2 and CRW JpgFromRaw tags.
+func (x *Exif) previewCandidates() []previewCandidate {
+	var c []previewCandidate
+	add := func(off *IfdTag, length *IfdTag) {
+		o, err1 := off.Int(0)
+		l, err2 := length.Int(0)
+		if err1 == nil && err2 == nil && l > 0 {
+			c = append(c, previewCandidate{int(o), int(l)})
+		}
+	}
+	for k, t := range x.Tags {
+		if strings.HasPrefix(k, "MakerNote ") {
+			// maker note offsets may not be relative to the TIFF header
+			continue
+		}
+		switch {
+		case strings.HasSuffix(k, " JPEGInterchangeFormat"):
+			ifd := strings.TrimSuffix(k, " JPEGInterchangeFormat")
+			if l, ok := x.Tags[ifd+" JPEGInterchangeFormatLength"]; ok {
+				add(t, l)
+			}
+		case strings.HasSuffix(k, " StripOffsets") && t.Count() == 1:
+			ifd := strings.TrimSuffix(k, " StripOffsets")
+			comp, ok1 := x.Tags[ifd+" Compression"]
+			l, ok2 := x.Tags[ifd+" StripByteCounts"]
+			if !ok1 || !ok2 {
+				continue
+			}
+			if v, err := comp.Int(0); err == nil && (v == 6 || v == 7) {
+				add(t, l)
+			}
+		case strings.HasSuffix(k, " JpgFromRaw"):
+			c = append(c, previewCandidate{t.fieldoffset, t.fieldlength})
+		}
+	}
+	// the largest first
+	sort.Slice(c, func(i, j int) bool {
+		if c[i].length != c[j].length {
+			return c[i].length > c[j].length
+		}
+		return c[i].offset < c[j].offset
+	})
+	return c
+}
+
+// isPreviewJPEG tells whether the length bytes at offset hold a baseline or progressive JPEG image,
+// unlike the lossless JPEG compressed raw data of CR2 and DNG files.
+func (eh *exifHeader) isPreviewJPEG(offset int, length int) bool {
+	start := eh.offset + int64(offset)
+	if offset < 0 || length < 4 || start+int64(length) > eh.size {
+		return false
+	}
+	r := io.NewSectionReader(eh.reader, start, int64(length))
+	soi := make([]byte, 2)
+	if _, err := r.ReadAt(soi, 0); err != nil || string(soi) != "\xFF\xD8" {
+		return false
+	}
+	pos := int64(2)
+	for {
+		seg, err := readJpegSegment(r, pos, int64(length))
+		if err != nil {
+			return false
+		}
+		switch seg.marker {
+		case 0xC0, 0xC1, 0xC2:
+			return true
+		case 0xC3, 0xC5, 0xC6, 0xC7, 0xC9, 0xCA, 0xCB, 0xCD, 0xCE, 0xCF, markerSOS, markerEOI:
+			return false
+		}
+		pos = seg.offset + seg.length
+	}
+}
+
+// Preview returns the largest JPEG image embedded in the file, which in RAW files is the
+// full-size or large preview, e.g. the IFD0 strip of CR2, the first SubIFD of NEF, the
+// JpgFromRaw tag of RW2 and CRW, the preview SubIFD of DNG files or the JPEG image of RAF
+// files. The lossless JPEG compressed raw data is never returned. The image is read through
+// the io.ReaderAt given to Decode, which must still be open. It returns ErrNoPreview when
+// there is no such image.
+func (x *Exif) Preview() ([]byte, error) {
+	if x.embedded != nil {
+		b := make([]byte, x.embedded.Size())
+		if _, err := x.embedded.ReadAt(b, 0); err != nil {
+			return nil, newFormatError(err, 0, x.embedded.Size(), x.embedded.Size())
+		}
+		return b, nil
+	}
+	if x.hdr == nil {
+		return nil, ErrNoPreview
+	}
+	for _, c := range x.previewCandidates() {
+		if x.hdr.isPreviewJPEG(c.offset, c.length) {
+			return x.hdr.readBytes(c.offset, c.length)
+		}
+	}
+	return nil, ErrNoPreview
+}
+
+// rafDecode decodes the Fujifilm RAF file of the given size read through r. The header,
+// "FUJIFILMCCD-RAW" followed by the format version and the camera ID and name, gives at
+// offset 84 the offset and length of a JPEG image holding the EXIF information, which is
+// also the preview of the file.
+func rafDecode(r io.ReaderAt, size int64, o *Options) (*Exif, error) {
+	b := make([]byte, 8)
+	if _, err := r.ReadAt(b, 84); err != nil {
+		return nil, newFormatError(err, 84, 8, size)
+	}
+	offset := int64(binary.BigEndian.Uint32(b))
+	length := int64(binary.BigEndian.Uint32(b[4:]))
+	if offset+length > size {
+		return nil, newFormatError(nil, offset, length, size)
+	}
+	o.writeInfo(" RAF JPEG image at offset", offset, "length", length)
+	jpg := io.NewSectionReader(r, offset, length)
+	// decoded through the JPEG path only, a pointer back to the RAF header cannot recurse
+	soi := make([]byte, 2)
+	if _, err := jpg.ReadAt(soi, 0); err != nil || string(soi) != "\xFF\xD8" {
+		return nil, &FormatError{Tag: -1, Offset: offset, Err: errors.New("missing JPEG image")}
+	}
+	x, err := Decode(jpg, length, o)
+	if err != nil {
+		return nil, err
+	}
+	x.Format = "RAF"
+	x.embedded = jpg
+	x.shiftOffsets(offset)
+	return x, nil
+}
+
+// shiftOffsets moves the absolute positions of the IFDs and tags by delta, for the EXIF
+// information of an image embedded at delta in the file.
+func (x *Exif) shiftOffsets(delta int64) {
+	done := make(map[*IfdTag]bool)
+	shift := func(t *IfdTag) {
+		if done[t] {
+			return
+		}
+		done[t] = true
+		if t.EntryOffset >= 0 {
+			t.EntryOffset += delta
+		}
+		if t.ValueOffset >= 0 {
+			t.ValueOffset += delta
+		}
+	}
+	for _, t := range x.Tags {
+		shift(t)
+	}
+	if x.hdr != nil {
+		for _, t := range x.hdr.keyed {
+			shift(t)
+		}
+	}
+	for _, ifd := range x.IfdList() {
+		ifd.Offset += delta
+		for _, e := range ifd.Entries {
+			shift(e.IfdTag)
+		}
+	}
+}
@@ -0,0 +1,168 @@
+package exif4go
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"image"
+	"image/jpeg"
+	"io/ioutil"
+	"testing"
+)
+
+// previewJPEG returns a baseline JPEG image.
+func previewJPEG(t *testing.T) []byte {
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, image.NewGray(image.Rect(0, 0, 64, 48)), nil); err != nil {
+		t.Fatalf("Error encoding the preview: %s", err)
+	}
+	return buf.Bytes()
+}
+
+// losslessJPEG returns data starting like lossless JPEG compressed raw data, larger than the preview.
+func losslessJPEG() []byte {
+	b := []byte("\xFF\xD8\xFF\xC3\x00\x0B\x0C\x00\x30\x00\x40\x01\x01\x11\x00\xFF\xDA\x00\x08\x01\x01\x00\x01\x00\x00")
+	return append(b, make([]byte, 8000)...)
+}
+
+// nefImage returns a NEF like file: IFD0 holds the lossless raw data as a single JPEG strip
+// and points to a SubIFD holding the preview as JPEGInterchangeFormat.
+func nefImage(t *testing.T, magic string, preview []byte, raw []byte) []byte {
+	order := binary.ByteOrder(binary.LittleEndian)
+	sub := func(j int) []*IfdTag {
+		tags := []*IfdTag{
+			NewLongTag(0x00FE, 1),
+			NewShortTag(0x0103, 6),
+			NewLongTag(0x0201, uint32(j)),
+			NewLongTag(0x0202, uint32(len(preview))),
+		}
+		sortTags(tags)
+		return tags
+	}
+	subsize := ifdSize(sub(0))
+	encode := func(at int) []byte {
+		ts := &TagSet{Image: []*IfdTag{
+			NewASCIITag(0x010F, "NIKON CORPORATION"),
+			NewShortTag(0x0103, 7),
+			NewLongTag(0x0111, uint32(at+subsize+len(preview))),
+			NewLongTag(0x0117, uint32(len(raw))),
+			NewLongTag(0x014A, uint32(at)),
+		}}
+		b, err := Encode(ts, order)
+		if err != nil {
+			t.Fatalf("Error encoding: %s", err)
+		}
+		return b
+	}
+	// the SubIFD follows the EXIF block, whose size does not depend on the offsets
+	at := len(encode(0))
+	b := append(encode(at), make([]byte, subsize)...)
+	writeIfd(b, at, sub(at+subsize), 0, order)
+	b = append(append(b, preview...), raw...)
+	copy(b, magic)
+	return b
+}
+
+func TestRawPreview(t *testing.T) {
+	preview, raw := previewJPEG(t), losslessJPEG()
+	for magic, format := range map[string]string{"II*\x00": "NEF", "IIRO": "ORF"} {
+		b := nefImage(t, magic, preview, raw)
+		x, err := Decode(bytes.NewReader(b), int64(len(b)), nil)
+		if err != nil {
+			t.Fatalf("There was an error: %s", err)
+		}
+		if x.Format != format {
+			t.Errorf("Expected the %s format, got %s", format, x.Format)
+		}
+		if tag, ok := x.Tags["SubIFD 0 NewSubfileType"]; !ok || tag.Printable != "1" {
+			t.Errorf("The SubIFD was not decoded: %v", tag)
+		}
+		p, err := x.Preview()
+		if err != nil {
+			t.Fatalf("There was an error: %s", err)
+		}
+		if !bytes.Equal(p, preview) {
+			t.Errorf("Expected the %d bytes preview, got %d bytes", len(preview), len(p))
+		}
+	}
+
+	// the raw data alone is not a preview
+	b := nefImage(t, "II*\x00", []byte{}, raw)
+	x, err := Decode(bytes.NewReader(b), int64(len(b)), nil)
+	if err != nil {
+		t.Fatalf("There was an error: %s", err)
+	}
+	if _, err := x.Preview(); err != ErrNoPreview {
+		t.Errorf("Expected ErrNoPreview, got %v", err)
+	}
+}
+
+func TestRW2(t *testing.T) {
+	preview := previewJPEG(t)
+	ts := &TagSet{Image: []*IfdTag{
+		NewASCIITag(0x010F, "Panasonic"),
+		NewShortTag(0x0002, 4016),
+		NewShortTag(0x0003, 3016),
+		NewUndefinedTag(0x002E, preview),
+	}}
+	b, err := Encode(ts, binary.LittleEndian)
+	if err != nil {
+		t.Fatalf("Error encoding: %s", err)
+	}
+	copy(b, "IIU\x00")
+	x, err := Decode(bytes.NewReader(b), int64(len(b)), nil)
+	if err != nil {
+		t.Fatalf("There was an error: %s", err)
+	}
+	if x.Format != "RW2" {
+		t.Errorf("Expected the RW2 format, got %s", x.Format)
+	}
+	if tag, ok := x.Tags["Image SensorWidth"]; !ok || tag.Printable != "4016" {
+		t.Errorf("Expected a 4016 pixels sensor width, got %v", tag)
+	}
+	if p, err := x.Preview(); err != nil || !bytes.Equal(p, preview) {
+		t.Errorf("Expected the %d bytes preview, got %d bytes (%v)", len(preview), len(p), err)
+	}
+}
+
+func TestRAF(t *testing.T) {
+	f := "./test/test.jpg"
+	jpg, err := ioutil.ReadFile(f)
+	if err != nil {
+		t.Fatal("Error reading file:", f)
+	}
+	hdr := make([]byte, 100)
+	copy(hdr, rafSignature+" 0201FF383501")
+	copy(hdr[28:], "FinePix S5Pro")
+	binary.BigEndian.PutUint32(hdr[84:], uint32(len(hdr)))
+	binary.BigEndian.PutUint32(hdr[88:], uint32(len(jpg)))
+	b := append(append(hdr, jpg...), make([]byte, 64)...)
+
+	x, err := Decode(bytes.NewReader(b), int64(len(b)), nil)
+	if err != nil {
+		t.Fatalf("There was an error: %s", err)
+	}
+	if x.Format != "RAF" {
+		t.Errorf("Expected the RAF format, got %s", x.Format)
+	}
+	if tag, ok := x.Tags["Image Model"]; !ok || tag.Printable != `"Canon EOS 1000D"` {
+		t.Errorf("Expected the model of the embedded JPEG image, got %v", tag)
+	}
+	// the positions are in the RAF file
+	checkOffsets(t, b, x, 12)
+	if p, err := x.Preview(); err != nil || !bytes.Equal(p, jpg) {
+		t.Errorf("Expected the embedded JPEG image as preview, got %d bytes (%v)", len(p), err)
+	}
+	if th, err := x.Thumbnail(); err != nil || len(th) != 7320 {
+		t.Errorf("Expected the thumbnail of the embedded JPEG image, got %d bytes (%v)", len(th), err)
+	}
+
+	// the JPEG image pointer refers to the RAF file itself
+	b = make([]byte, 200)
+	copy(b, rafSignature)
+	binary.BigEndian.PutUint32(b[88:], 200)
+	var fe *FormatError
+	if _, err := Decode(bytes.NewReader(b), int64(len(b)), nil); !errors.As(err, &fe) {
+		t.Errorf("Expected a *FormatError, got %v", err)
+	}
+}
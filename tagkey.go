@@ -0,0 +1,184 @@
+package exif4go
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// IfdID identifies the IFDs of the EXIF information.
+type IfdID uint16
+
+const (
+	// IFD0, the main image
+	IfdImage IfdID = iota
+	// IFD1, the thumbnail image
+	IfdThumbnail
+	// EXIF SubIFD
+	IfdExif
+	// GPS SubIFD
+	IfdGPS
+	// Interoperability SubSubIFD, contained in the EXIF SubIFD
+	IfdInterop
+	// the IFD of the Canon and Nikon MakerNotes, whose tag IDs depend on the camera make
+	IfdMakerNote
+)
+
+// ifdNames are the names prefixing the tags of each IFD in Exif.Tags, by IfdID.
+var ifdNames = []string{"Image", "Thumbnail", "EXIF", "GPS", "EXIF Interoperability", "MakerNote"}
+
+// ifdID returns the IfdID of the IFD with the given name.
+func ifdID(name string) (IfdID, bool) {
+	for i, n := range ifdNames {
+		if n == name {
+			return IfdID(i), true
+		}
+	}
+	return 0, false
+}
+
+func (id IfdID) String() string {
+	if int(id) < len(ifdNames) {
+		return ifdNames[id]
+	}
+	return fmt.Sprintf("IFD 0x%04X", uint16(id))
+}
+
+// dict returns the tag dictionary of the IFD, nil when the tag names depend on the file.
+func (id IfdID) dict() map[int]*exifTag {
+	switch id {
+	case IfdImage, IfdThumbnail, IfdExif:
+		return exifTags
+	case IfdGPS:
+		return gpsTags
+	case IfdInterop:
+		return interTags
+	}
+	return nil
+}
+
+// TagKey identifies a tag by its IFD and tag ID. Unlike the names keying Exif.Tags, it does not
+// depend on the tags known by the package.
+type TagKey uint32
+
+// NewTagKey returns the key of the tag of the given IFD.
+func NewTagKey(ifd IfdID, tag uint16) TagKey {
+	return TagKey(ifd)<<16 | TagKey(tag)
+}
+
+// Well-known tags.
+const (
+	ImageWidth                           = TagKey(IfdImage)<<16 | 0x0100
+	ImageLength                          = TagKey(IfdImage)<<16 | 0x0101
+	ImageDescription                     = TagKey(IfdImage)<<16 | 0x010E
+	ImageMake                            = TagKey(IfdImage)<<16 | 0x010F
+	ImageModel                           = TagKey(IfdImage)<<16 | 0x0110
+	ImageOrientation                     = TagKey(IfdImage)<<16 | 0x0112
+	ImageXResolution                     = TagKey(IfdImage)<<16 | 0x011A
+	ImageYResolution                     = TagKey(IfdImage)<<16 | 0x011B
+	ImageResolutionUnit                  = TagKey(IfdImage)<<16 | 0x0128
+	ImageSoftware                        = TagKey(IfdImage)<<16 | 0x0131
+	ImageDateTime                        = TagKey(IfdImage)<<16 | 0x0132
+	ImageArtist                          = TagKey(IfdImage)<<16 | 0x013B
+	ImageCopyright                       = TagKey(IfdImage)<<16 | 0x8298
+	ImageExifOffset                      = TagKey(IfdImage)<<16 | 0x8769
+	ImageGPSInfo                         = TagKey(IfdImage)<<16 | 0x8825
+	ThumbnailCompression                 = TagKey(IfdThumbnail)<<16 | 0x0103
+	ThumbnailJPEGInterchangeFormat       = TagKey(IfdThumbnail)<<16 | 0x0201
+	ThumbnailJPEGInterchangeFormatLength = TagKey(IfdThumbnail)<<16 | 0x0202
+	ExifExposureTime                     = TagKey(IfdExif)<<16 | 0x829A
+	ExifFNumber                          = TagKey(IfdExif)<<16 | 0x829D
+	ExifISOSpeedRatings                  = TagKey(IfdExif)<<16 | 0x8827
+	ExifDateTimeOriginal                 = TagKey(IfdExif)<<16 | 0x9003
+	ExifDateTimeDigitized                = TagKey(IfdExif)<<16 | 0x9004
+	ExifOffsetTime                       = TagKey(IfdExif)<<16 | 0x9010
+	ExifOffsetTimeOriginal               = TagKey(IfdExif)<<16 | 0x9011
+	ExifOffsetTimeDigitized              = TagKey(IfdExif)<<16 | 0x9012
+	ExifFlash                            = TagKey(IfdExif)<<16 | 0x9209
+	ExifFocalLength                      = TagKey(IfdExif)<<16 | 0x920A
+	ExifMakerNote                        = TagKey(IfdExif)<<16 | 0x927C
+	ExifUserComment                      = TagKey(IfdExif)<<16 | 0x9286
+	ExifImageWidth                       = TagKey(IfdExif)<<16 | 0xA002
+	ExifImageLength                      = TagKey(IfdExif)<<16 | 0xA003
+	ExifInteroperabilityOffset           = TagKey(IfdExif)<<16 | 0xA005
+	ExifCameraOwnerName                  = TagKey(IfdExif)<<16 | 0xA430
+	ExifBodySerialNumber                 = TagKey(IfdExif)<<16 | 0xA431
+	ExifLensMake                         = TagKey(IfdExif)<<16 | 0xA433
+	ExifLensModel                        = TagKey(IfdExif)<<16 | 0xA434
+	GPSLatitudeRef                       = TagKey(IfdGPS)<<16 | 0x0001
+	GPSLatitude                          = TagKey(IfdGPS)<<16 | 0x0002
+	GPSLongitudeRef                      = TagKey(IfdGPS)<<16 | 0x0003
+	GPSLongitude                         = TagKey(IfdGPS)<<16 | 0x0004
+	GPSAltitudeRef                       = TagKey(IfdGPS)<<16 | 0x0005
+	GPSAltitude                          = TagKey(IfdGPS)<<16 | 0x0006
+	GPSTimeStamp                         = TagKey(IfdGPS)<<16 | 0x0007
+	GPSDateStamp                         = TagKey(IfdGPS)<<16 | 0x001D
+	InteropIndex                         = TagKey(IfdInterop)<<16 | 0x0001
+)
+
+// Ifd returns the IFD of the tag.
+func (k TagKey) Ifd() IfdID {
+	return IfdID(k >> 16)
+}
+
+// Tag returns the tag ID.
+func (k TagKey) Tag() uint16 {
+	return uint16(k)
+}
+
+// Name returns the name of the tag, e.g. "EXIF DateTimeOriginal", which keys the tag in
+// Exif.Tags. The tags the package does not know are named after their ID, e.g. "EXIF Tag 0xA500",
+// and are only found with Exif.Get, as are the MakerNote tags, whose names depend on the camera
+// make and which are always named after their ID, e.g. "MakerNote Tag 0x0001".
+func (k TagKey) Name() string {
+	if e, ok := k.Ifd().dict()[int(k.Tag())]; ok {
+		return k.Ifd().String() + " " + e.name
+	}
+	return fmt.Sprintf("%s Tag 0x%04X", k.Ifd(), k.Tag())
+}
+
+func (k TagKey) String() string {
+	return k.Name()
+}
+
+// LookupTagKey returns the key of the tag with the given name as returned by TagKey.Name, e.g.
+// "GPS GPSLatitude" or "EXIF Tag 0xA500". Only the tags of the IFDs with an IfdID have a key.
+func LookupTagKey(name string) (TagKey, bool) {
+	// backwards, so that "EXIF Interoperability" is tried before "EXIF"
+	for id := len(ifdNames) - 1; id >= 0; id-- {
+		prefix := ifdNames[id] + " "
+		if !strings.HasPrefix(name, prefix) {
+			continue
+		}
+		tagname := strings.TrimPrefix(name, prefix)
+		if strings.HasPrefix(tagname, "Tag 0x") {
+			tag, err := strconv.ParseUint(tagname[len("Tag 0x"):], 16, 16)
+			if err != nil {
+				return 0, false
+			}
+			return NewTagKey(IfdID(id), uint16(tag)), true
+		}
+		for tag, e := range IfdID(id).dict() {
+			if e.name == tagname {
+				return NewTagKey(IfdID(id), uint16(tag)), true
+			}
+		}
+		return 0, false
+	}
+	return 0, false
+}
+
+// Get returns the tag with the given key.
+func (x *Exif) Get(k TagKey) (*IfdTag, bool) {
+	if x.hdr == nil {
+		return nil, false
+	}
+	t, ok := x.hdr.keyed[k]
+	return t, ok
+}
+
+// setTag stores a tag derived from other tags under its key and its name.
+func (eh *exifHeader) setTag(k TagKey, t *IfdTag) {
+	eh.tags[k.Name()] = t
+	eh.keyed[k] = t
+}
@@ -0,0 +1,65 @@
+package exif4go
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+)
+
+func TestTagKey(t *testing.T) {
+	ts := &TagSet{
+		Image: []*IfdTag{NewASCIITag(0x010F, "Canon")},
+		Exif: []*IfdTag{
+			NewASCIITag(0x9003, "2020:01:02 03:04:05"),
+			NewShortTag(0xA5FF, 7),
+		},
+		Interop: []*IfdTag{NewASCIITag(0x0001, "R98")},
+		GPS:     []*IfdTag{NewASCIITag(0x0001, "N")},
+	}
+	b, err := Encode(ts, binary.BigEndian)
+	if err != nil {
+		t.Fatalf("Error encoding: %s", err)
+	}
+	x, err := Decode(bytes.NewReader(b), int64(len(b)), nil)
+	if err != nil {
+		t.Fatalf("There was an error: %s", err)
+	}
+	unknown := NewTagKey(IfdExif, 0xA5FF)
+	for k, name := range map[TagKey]string{
+		ImageMake:            "Image Make",
+		ExifDateTimeOriginal: "EXIF DateTimeOriginal",
+		InteropIndex:         "EXIF Interoperability InteroperabilityIndex",
+		GPSLatitudeRef:       "GPS GPSLatitudeRef",
+	} {
+		if k.Name() != name {
+			t.Errorf("Expected the %s name, got %s", name, k.Name())
+		}
+		tag, ok := x.Get(k)
+		if !ok || tag != x.Tags[name] {
+			t.Errorf("Expected the %s tag, got %v", name, tag)
+		}
+		if l, ok := LookupTagKey(name); !ok || l != k {
+			t.Errorf("Expected the %08X key for %s, got %08X", uint32(k), name, uint32(l))
+		}
+	}
+
+	// the unknown tags are only found by key
+	if k := unknown; k.Ifd() != IfdExif || k.Tag() != 0xA5FF || k.Name() != "EXIF Tag 0xA5FF" {
+		t.Errorf("Unexpected IFD %s and tag 0x%04X", k.Ifd(), k.Tag())
+	}
+	if tag, ok := x.Get(unknown); !ok || tag.Printable != "7" {
+		t.Errorf("Expected the unknown tag, got %v", tag)
+	}
+	if tag, ok := x.Tags[unknown.Name()]; ok {
+		t.Errorf("Unexpected unknown tag %v in Tags", tag)
+	}
+	if l, ok := LookupTagKey("EXIF Tag 0xA5FF"); !ok || l != unknown {
+		t.Errorf("Expected the %08X key, got %08X", uint32(unknown), uint32(l))
+	}
+	if _, ok := x.Get(ExifLensModel); ok {
+		t.Errorf("Unexpected LensModel tag")
+	}
+	if _, ok := LookupTagKey("SubIFD 0 ImageWidth"); ok {
+		t.Errorf("Unexpected key for a SubIFD tag")
+	}
+}
@@ -0,0 +1,245 @@
+package exif4go
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/jpeg"
+)
+
+// TIFF tags locating the image data of an uncompressed thumbnail
+const (
+	stripOffsetsTag    = 0x0111
+	stripByteCountsTag = 0x0117
+)
+
+// isThumbnailIfd tells whether IFD1 describes a thumbnail rather than a page of a multi-page
+// TIFF file: it is flagged as a reduced resolution image, or IFD0 has no image data of its own,
+// as in the EXIF blocks, whose IFD0 describes the primary image stored elsewhere.
+func (eh *exifHeader) isThumbnailIfd() bool {
+	if t, ok := eh.keyed[NewTagKey(IfdThumbnail, 0x00FE)]; ok {
+		if v, err := t.Int(0); err == nil && v&1 != 0 {
+			return true
+		}
+	}
+	_, strips := eh.keyed[NewTagKey(IfdImage, stripOffsetsTag)]
+	_, tiles := eh.keyed[NewTagKey(IfdImage, 0x0144)]
+	return !strips && !tiles
+}
+
+// extractTiffThumbnail assembles a standalone TIFF file from the uncompressed thumbnail
+// described by the IFD at offset ifd: the IFD entries are copied with the values that do not
+// fit in them, followed by the image strips, and all the offsets are rewritten accordingly.
+func (eh *exifHeader) extractTiffThumbnail(ifd int) ([]byte, error) {
+	if eh.bigTiff {
+		return nil, errors.New("uncompressed thumbnails of BigTIFF files are not supported")
+	}
+	entries, err := eh.s2n(ifd, 2, false)
+	if err != nil {
+		return nil, err
+	}
+	order := eh.byteOrder()
+
+	var tiff []byte
+	if eh.endian[0] == 'I' {
+		tiff = []byte("II*\x00\x08\x00\x00\x00")
+	} else {
+		tiff = []byte("MM\x00*\x00\x00\x00\x08")
+	}
+	// the IFD is copied as is and terminates the IFD chain
+	b, err := eh.readBytes(ifd, 2+12*entries)
+	if err != nil {
+		return nil, err
+	}
+	tiff = append(tiff, b...)
+	tiff = append(tiff, 0, 0, 0, 0)
+
+	// position in tiff of the strip offsets and their size
+	var stripoff, striplen int
+	var offsets, counts []int
+	for i := 0; i < entries; i++ {
+		entry := ifd + 2 + 12*i
+		// position of the entry value in tiff
+		ptr := 8 + 2 + 12*i + 8
+		tag, _ := eh.s2n(entry, 2, false)
+		fieldtype, _ := eh.s2n(entry+2, 2, false)
+		count, err := eh.s2n(entry+4, 4, false)
+		if err != nil {
+			return nil, err
+		}
+		if !knownFieldType(fieldtype) {
+			return nil, fmt.Errorf("unknown type %d in tag 0x%04X", fieldtype, tag)
+		}
+		typelen := int(FieldTypeOf(fieldtype).Size)
+		if int64(count) > (eh.size-eh.offset)/int64(typelen) {
+			return nil, &FormatError{Ifd: "Thumbnail", Tag: tag, Offset: eh.offset + int64(entry), Err: ErrInvalidOffset}
+		}
+		length := count * typelen
+		value := entry + 8
+		if length > 4 {
+			if value, err = eh.s2n(entry+8, 4, false); err != nil {
+				return nil, err
+			}
+		}
+		switch tag {
+		case stripOffsetsTag, stripByteCountsTag:
+			if fieldtype != 3 && fieldtype != 4 {
+				return nil, fmt.Errorf("unexpected type %d in tag 0x%04X", fieldtype, tag)
+			}
+			v := make([]int, count)
+			for j := range v {
+				if v[j], err = eh.s2n(value+j*typelen, uint(typelen), false); err != nil {
+					return nil, err
+				}
+			}
+			if tag == stripOffsetsTag {
+				offsets, stripoff, striplen = v, ptr, typelen
+			} else {
+				counts = v
+			}
+		}
+		if length > 4 {
+			// the value follows the IFD, on a word boundary
+			if len(tiff)%2 == 1 {
+				tiff = append(tiff, 0)
+			}
+			order.PutUint32(tiff[ptr:], uint32(len(tiff)))
+			if tag == stripOffsetsTag {
+				stripoff = len(tiff)
+			}
+			if b, err = eh.readBytes(value, length); err != nil {
+				return nil, err
+			}
+			tiff = append(tiff, b...)
+		}
+	}
+	if offsets == nil || len(offsets) != len(counts) {
+		return nil, &FormatError{Ifd: "Thumbnail", Tag: stripOffsetsTag, Offset: eh.offset + int64(ifd), Err: errors.New("missing or inconsistent thumbnail strips")}
+	}
+
+	// append the pixel strips and update the strip offsets
+	for i, off := range offsets {
+		pos := len(tiff)
+		if striplen == 2 {
+			if pos > 0xFFFF {
+				return nil, fmt.Errorf("thumbnail strip offset %d does not fit in a short", pos)
+			}
+			order.PutUint16(tiff[stripoff+2*i:], uint16(pos))
+		} else {
+			order.PutUint32(tiff[stripoff+4*i:], uint32(pos))
+		}
+		if b, err = eh.readBytes(off, counts[i]); err != nil {
+			return nil, err
+		}
+		tiff = append(tiff, b...)
+	}
+	return tiff, nil
+}
+
+// ThumbnailImage decodes the thumbnail returned by Thumbnail. JPEG thumbnails are decoded
+// with image/jpeg, uncompressed TIFF thumbnails are supported for 8 bits grayscale and RGB pixels.
+func (x *Exif) ThumbnailImage() (image.Image, error) {
+	b, err := x.Thumbnail()
+	if err != nil {
+		return nil, err
+	}
+	if bytes.HasPrefix(b, []byte("\xFF\xD8")) {
+		return jpeg.Decode(bytes.NewReader(b))
+	}
+	return decodeTiffThumbnail(b)
+}
+
+// decodeTiffThumbnail decodes a standalone TIFF file built by extractTiffThumbnail.
+func decodeTiffThumbnail(b []byte) (image.Image, error) {
+	if len(b) < 8 || (string(b[0:4]) != "II*\x00" && string(b[0:4]) != "MM\x00*") {
+		return nil, ErrUnknownFormat
+	}
+	hdr := newExifHeader(bytes.NewReader(b), int64(len(b)), b[0:1], 0, (&Options{Strict: true}).withDefaults())
+	ifd, err := hdr.firstIfd()
+	if err != nil {
+		return nil, err
+	}
+	if err := hdr.dumpIfd(ifd, "Thumbnail", exifTags, "UNDEF"); err != nil {
+		return nil, err
+	}
+	tags := hdr.takeIfd("Thumbnail", int64(ifd), exifTags).Tags
+
+	// value returns item i of a tag, or def when the tag is missing
+	value := func(name string, i int, def int) (int, error) {
+		t, ok := tags[name]
+		if !ok {
+			return def, nil
+		}
+		v, err := t.Int(i)
+		return int(v), err
+	}
+	var width, height, compression, photometric, samples, bits, planar int
+	for _, f := range []struct {
+		v    *int
+		name string
+		def  int
+	}{
+		{&width, "ImageWidth", 0},
+		{&height, "ImageLength", 0},
+		{&compression, "Compression", 1},
+		{&photometric, "PhotometricInterpretation", -1},
+		{&samples, "SamplesPerPixel", 1},
+		{&bits, "BitsPerSample", 1},
+		{&planar, "PlanarConfiguration", 1},
+	} {
+		if *f.v, err = value(f.name, 0, f.def); err != nil {
+			return nil, err
+		}
+	}
+	if compression != 1 || bits != 8 || planar != 1 {
+		return nil, fmt.Errorf("unsupported TIFF thumbnail: compression %d, %d bits per sample, planar configuration %d", compression, bits, planar)
+	}
+
+	var pix []byte
+	offsets, counts := tags["StripOffsets"], tags["StripByteCounts"]
+	if offsets == nil || counts == nil {
+		return nil, errors.New("missing thumbnail strips")
+	}
+	for i := 0; i < offsets.Count(); i++ {
+		off, err := offsets.Int(i)
+		if err != nil {
+			return nil, err
+		}
+		n, err := counts.Int(i)
+		if err != nil {
+			return nil, err
+		}
+		s, err := hdr.readBytes(int(off), int(n))
+		if err != nil {
+			return nil, err
+		}
+		pix = append(pix, s...)
+	}
+	// checked before multiplying, width*height*samples could overflow
+	if width <= 0 || height <= 0 || samples <= 0 || width > len(pix) || height > len(pix)/width/samples {
+		return nil, fmt.Errorf("thumbnail data too short for a %dx%d image", width, height)
+	}
+
+	switch {
+	case (photometric == 0 || photometric == 1) && samples == 1:
+		img := image.NewGray(image.Rect(0, 0, width, height))
+		copy(img.Pix, pix)
+		if photometric == 0 {
+			// white is zero
+			for i, p := range img.Pix {
+				img.Pix[i] = 255 - p
+			}
+		}
+		return img, nil
+	case photometric == 2 && samples >= 3:
+		img := image.NewRGBA(image.Rect(0, 0, width, height))
+		for i := 0; i < width*height; i++ {
+			p := pix[i*samples:]
+			img.SetRGBA(i%width, i/width, color.RGBA{p[0], p[1], p[2], 0xFF})
+		}
+		return img, nil
+	}
+	return nil, fmt.Errorf("unsupported TIFF thumbnail: photometric interpretation %d with %d samples per pixel", photometric, samples)
+}
@@ -0,0 +1,193 @@
+package exif4go
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"image/color"
+	"io/ioutil"
+	"testing"
+)
+
+func TestTiffThumbnail(t *testing.T) {
+	pix := []byte{
+		0xFF, 0x00, 0x00, 0x00, 0xFF, 0x00,
+		0x00, 0x00, 0xFF, 0x80, 0x80, 0x80,
+	}
+	for _, order := range []binary.ByteOrder{binary.LittleEndian, binary.BigEndian} {
+		encode := func(stripoff uint32) []byte {
+			ts := &TagSet{
+				Image: []*IfdTag{NewASCIITag(0x010F, "Canon")},
+				Thumbnail: []*IfdTag{
+					NewShortTag(0x0100, 2),
+					NewShortTag(0x0101, 2),
+					NewShortTag(0x0102, 8, 8, 8),
+					NewShortTag(0x0103, 1),
+					NewShortTag(0x0106, 2),
+					NewLongTag(0x0111, stripoff),
+					NewShortTag(0x0115, 3),
+					NewShortTag(0x0116, 2),
+					NewLongTag(0x0117, uint32(len(pix))),
+				},
+			}
+			b, err := Encode(ts, order)
+			if err != nil {
+				t.Fatalf("Error encoding: %s", err)
+			}
+			return b
+		}
+		// the strip follows the EXIF block, whose size does not depend on the strip offset
+		b := encode(uint32(len(encode(0))))
+		b = append(b, pix...)
+
+		x, err := Decode(bytes.NewReader(b), int64(len(b)), nil)
+		if err != nil {
+			t.Fatalf("There was an error: %s", err)
+		}
+		thumb, err := x.Thumbnail()
+		if err != nil {
+			t.Fatalf("There was an error: %s", err)
+		}
+		if !bytes.HasSuffix(thumb, pix) {
+			t.Errorf("The %v thumbnail does not end with the strip", order)
+		}
+		img, err := x.ThumbnailImage()
+		if err != nil {
+			t.Fatalf("Error decoding the %v thumbnail: %s", order, err)
+		}
+		if r := img.Bounds(); r.Dx() != 2 || r.Dy() != 2 {
+			t.Errorf("Expected a 2x2 image, got %v", r)
+		}
+		for i, c := range []color.RGBA{{0xFF, 0, 0, 0xFF}, {0, 0xFF, 0, 0xFF}, {0, 0, 0xFF, 0xFF}, {0x80, 0x80, 0x80, 0xFF}} {
+			if got := color.RGBAModel.Convert(img.At(i%2, i/2)); got != c {
+				t.Errorf("Pixel %d: expected %v, got %v", i, c, got)
+			}
+		}
+	}
+}
+
+func TestTiffThumbnailOverflow(t *testing.T) {
+	// 2^31 x 2^31 pixels of 4 samples, whose size wraps around to 0
+	pix := make([]byte, 16)
+	encode := func(stripoff uint32) []byte {
+		ts := &TagSet{
+			Image: []*IfdTag{NewASCIITag(0x010F, "Canon")},
+			Thumbnail: []*IfdTag{
+				NewLongTag(0x0100, 1<<31),
+				NewLongTag(0x0101, 1<<31),
+				NewShortTag(0x0102, 8, 8, 8, 8),
+				NewShortTag(0x0103, 1),
+				NewShortTag(0x0106, 2),
+				NewLongTag(0x0111, stripoff),
+				NewShortTag(0x0115, 4),
+				NewLongTag(0x0116, 1<<31),
+				NewLongTag(0x0117, uint32(len(pix))),
+			},
+		}
+		b, err := Encode(ts, binary.LittleEndian)
+		if err != nil {
+			t.Fatalf("Error encoding: %s", err)
+		}
+		return b
+	}
+	b := append(encode(uint32(len(encode(0)))), pix...)
+	x, err := Decode(bytes.NewReader(b), int64(len(b)), nil)
+	if err != nil {
+		t.Fatalf("There was an error: %s", err)
+	}
+	if _, err := x.Thumbnail(); err != nil {
+		t.Fatalf("There was an error: %s", err)
+	}
+	if _, err := x.ThumbnailImage(); err == nil {
+		t.Errorf("Expected an error for the oversized thumbnail")
+	}
+}
+
+func TestTiffThumbnailStripCount(t *testing.T) {
+	pix := make([]byte, 4)
+	encode := func(stripoff uint32) []byte {
+		ts := &TagSet{
+			Image: []*IfdTag{NewASCIITag(0x010F, "Canon")},
+			Thumbnail: []*IfdTag{
+				NewShortTag(0x0100, 2),
+				NewShortTag(0x0101, 2),
+				NewShortTag(0x0103, 1),
+				NewLongTag(0x0111, stripoff),
+				NewLongTag(0x0117, uint32(len(pix))),
+			},
+		}
+		b, err := Encode(ts, binary.LittleEndian)
+		if err != nil {
+			t.Fatalf("Error encoding: %s", err)
+		}
+		return b
+	}
+	b := append(encode(uint32(len(encode(0)))), pix...)
+	x, err := Decode(bytes.NewReader(b), int64(len(b)), nil)
+	if err != nil {
+		t.Fatalf("There was an error: %s", err)
+	}
+	// 2^31 strip offsets, 16 GB of them
+	entry := x.Tags["Thumbnail StripOffsets"].EntryOffset
+	binary.LittleEndian.PutUint32(b[entry+4:], 0x7FFFFFFF)
+	if x, err = Decode(bytes.NewReader(b), int64(len(b)), nil); err != nil {
+		t.Fatalf("There was an error: %s", err)
+	}
+	if _, err := x.Thumbnail(); err == nil {
+		t.Errorf("Expected an error for the strip count")
+	}
+	if _, err := Decode(bytes.NewReader(b), int64(len(b)), &Options{Strict: true}); !errors.Is(err, ErrInvalidOffset) {
+		t.Errorf("Expected ErrInvalidOffset, got %v", err)
+	}
+}
+
+func TestUncompressedPages(t *testing.T) {
+	// two uncompressed 2x2 grayscale pages, the second one is not a thumbnail
+	order := binary.LittleEndian
+	page := func(strip int) []*IfdTag {
+		return []*IfdTag{
+			NewShortTag(0x0100, 2),
+			NewShortTag(0x0101, 2),
+			NewShortTag(0x0103, 1),
+			NewShortTag(0x0106, 1),
+			NewLongTag(0x0111, uint32(strip)),
+			NewLongTag(0x0117, 4),
+		}
+	}
+	ifd1 := 8 + ifdSize(page(0))
+	strips := ifd1 + ifdSize(page(0))
+	b := make([]byte, strips+8)
+	copy(b, "II*\x00")
+	order.PutUint32(b[4:], 8)
+	writeIfd(b, 8, page(strips), ifd1, order)
+	writeIfd(b, ifd1, page(strips+4), 0, order)
+	x, err := Decode(bytes.NewReader(b), int64(len(b)), nil)
+	if err != nil {
+		t.Fatalf("There was an error: %s", err)
+	}
+	if len(x.Pages()) != 2 {
+		t.Errorf("Expected 2 pages, got %d", len(x.Pages()))
+	}
+	if th, err := x.Thumbnail(); err != ErrNoThumbnail {
+		t.Errorf("Expected ErrNoThumbnail, got %d bytes (%v)", len(th), err)
+	}
+}
+
+func TestJPEGThumbnailImage(t *testing.T) {
+	fpath := "./test/test.jpg"
+	b, err := ioutil.ReadFile(fpath)
+	if err != nil {
+		t.Fatal("Error reading file:", fpath)
+	}
+	x, err := Decode(bytes.NewReader(b), int64(len(b)), nil)
+	if err != nil {
+		t.Fatalf("There was an error: %s", err)
+	}
+	img, err := x.ThumbnailImage()
+	if err != nil {
+		t.Fatalf("Error decoding the thumbnail: %s", err)
+	}
+	if r := img.Bounds(); r.Dx() != 160 || r.Dy() != 120 {
+		t.Errorf("Expected a 160x120 thumbnail, got %v", r)
+	}
+}
@@ -0,0 +1,47 @@
+package exif4go
+
+import (
+	"encoding/binary"
+	"io"
+)
+
+// webpExif locates the EXIF chunk of the RIFF/WEBP image of the given size read through r.
+// It returns the reader holding the TIFF structure, its size and the offset of the TIFF header.
+// The EXIF chunk is only present in the extended format, announced by a VP8X chunk,
+// but all the chunks are walked so that files with a missing VP8X flag are read as well.
+func webpExif(r io.ReaderAt, size int64) (io.ReaderAt, int64, int64, error) {
+	// the RIFF size counts from the WEBP form type
+	hdr := make([]byte, 8)
+	if _, err := r.ReadAt(hdr, 4); err != nil {
+		return nil, 0, 0, newFormatError(err, 4, 8, size)
+	}
+	end := 8 + int64(binary.LittleEndian.Uint32(hdr))
+	if end > size {
+		// tolerate a truncated file, the chunks are checked against the file size
+		end = size
+	}
+	offset := int64(12)
+	for offset+8 <= end {
+		if _, err := r.ReadAt(hdr, offset); err != nil {
+			return nil, 0, 0, newFormatError(err, offset, 8, size)
+		}
+		length := int64(binary.LittleEndian.Uint32(hdr[4:8]))
+		data := offset + 8
+		if data+length > end {
+			return nil, 0, 0, newFormatError(nil, data, length, end)
+		}
+		if string(hdr[0:4]) == "EXIF" {
+			// some encoders keep the JPEG APP1 prefix
+			prefix := make([]byte, len(exifPrefix))
+			if length >= int64(len(prefix)) {
+				if _, err := r.ReadAt(prefix, data); err == nil && string(prefix) == exifPrefix {
+					data += int64(len(prefix))
+				}
+			}
+			return r, offset + 8 + length, data, nil
+		}
+		// chunks are padded to an even size
+		offset = data + length + length%2
+	}
+	return nil, 0, 0, ErrNoExif
+}
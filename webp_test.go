@@ -0,0 +1,57 @@
+package exif4go
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+)
+
+// webpImage returns an extended format WebP file holding the given chunks.
+func webpImage(chunks ...[]byte) []byte {
+	b := []byte("RIFF\x00\x00\x00\x00WEBP")
+	for _, c := range chunks {
+		b = append(b, c...)
+	}
+	binary.LittleEndian.PutUint32(b[4:], uint32(len(b)-8))
+	return b
+}
+
+// riffChunk returns a RIFF chunk padded to an even size.
+func riffChunk(typ string, data []byte) []byte {
+	b := append([]byte(typ), binary.LittleEndian.AppendUint32(nil, uint32(len(data)))...)
+	b = append(b, data...)
+	if len(data)%2 == 1 {
+		b = append(b, 0)
+	}
+	return b
+}
+
+func TestWebP(t *testing.T) {
+	ts := &TagSet{Image: []*IfdTag{NewASCIITag(0x010F, "Canon"), NewASCIITag(0x0110, "Canon EOS 1000D")}}
+	blob, err := Encode(ts, binary.LittleEndian)
+	if err != nil {
+		t.Fatalf("Error encoding: %s", err)
+	}
+	// VP8X with the EXIF flag set, 1x1 canvas
+	vp8x := riffChunk("VP8X", []byte{0x08, 0, 0, 0, 0, 0, 0, 0, 0, 0})
+	// an odd sized chunk before EXIF checks the padding
+	images := map[string][]byte{
+		"plain":    webpImage(vp8x, riffChunk("ICCP", []byte{1, 2, 3}), riffChunk("VP8L", make([]byte, 5)), riffChunk("EXIF", blob)),
+		"prefixed": webpImage(vp8x, riffChunk("VP8 ", make([]byte, 10)), riffChunk("EXIF", append([]byte(exifPrefix), blob...))),
+	}
+	for name, b := range images {
+		x, err := Decode(bytes.NewReader(b), int64(len(b)), nil)
+		if err != nil {
+			t.Errorf("Error decoding the %s image: %s", name, err)
+			continue
+		}
+		if tag, ok := x.Tags["Image Model"]; !ok || tag.Printable != `"Canon EOS 1000D"` {
+			t.Errorf("Expected the model in the %s image, got %v", name, tag)
+		}
+	}
+
+	b := webpImage(riffChunk("VP8L", make([]byte, 5)))
+	if _, err := Decode(bytes.NewReader(b), int64(len(b)), nil); err != ErrNoExif {
+		t.Errorf("Expected ErrNoExif, got %v", err)
+	}
+}